@@ -24,12 +24,20 @@
 
 package cli
 
+import "time"
+
 type Config struct {
 	ConfigFile string
 	EnvPrefix  string
 	HomeFolder string
 	Data       struct {
-		Path string // path to data files
+		Path     string // path to data files
+		Galaxy   string // galaxy file, relative to Path
+		Accounts string // accounts file, relative to Path
+		Lenient  bool   // keep unknown system kinds instead of failing
+		// validation rules applied when loading galaxies
+		Bounds        int     // systems must be within -Bounds..Bounds on each axis; 0 is unbounded
+		MinSeparation float64 // minimum distance between systems; 0 allows shared coordinates
 	}
 	Flags struct {
 		Debug   bool
@@ -37,9 +45,71 @@ type Config struct {
 		Test    bool
 		Verbose bool
 	}
+	Generate struct {
+		Seed     int64  // seed for the random number generator
+		Size     int    // systems are placed within -Size..Size on each axis
+		Count    int    // number of systems
+		Shape    string // distribution of systems
+		Arms     int    // number of arms in a spiral
+		Clusters int    // number of clusters
+		Kinds    string // weights for kinds as "kind=weight,..."
+	}
+	Scan struct {
+		Width       int           // output width in pixels
+		Height      int           // output height in pixels
+		Supersample int           // supersampling factor
+		Fovy        float64       // vertical field of view in degrees
+		Near        float64       // near clipping plane
+		Far         float64       // far clipping plane
+		Eye         string        // camera position as "x,y,z"
+		Center      string        // view center position as "x,y,z"
+		Up          string        // up vector as "x,y,z"
+		Light       string        // light direction as "x,y,z"
+		Background  string        // background color as hex
+		Styles      string        // path to style file
+		Format      string        // output format: png, svg or lines
+		Output      string        // output file; the default depends on the format
+		Labels      bool          // label systems
+		Coordinates bool          // label systems with their coordinates
+		Planets     bool          // label systems with the number of planets they have
+		FontSize    float64       // label size in pixels; 0 scales with the image
+		Grid        int           // distance between grid lines; 0 hides the grid
+		GridPlanes  string        // grid planes as "xy,xz,yz"
+		Origin      string        // origin of the axes and grid planes as "x,y,z"
+		Axes        bool          // draw the axes
+		Frames      int           // number of frames in a turntable
+		Elevation   float64       // turntable camera elevation in degrees
+		Delay       time.Duration // time between turntable frames
+		Workers     int           // number of rendering goroutines; 0 is one per CPU
+		TileSize    int           // tile width and height in pixels; 0 renders one tile
+		MemoryLimit int           // megabytes of tile buffers rendered at the same time
+	}
+	Slices struct {
+		Axis       string // axis to slice along
+		Thickness  int    // number of coordinates in each layer
+		Box        string // sector as "x1,y1,z1,x2,y2,z2"; all systems if empty
+		Width      int    // width of each map in pixels
+		Height     int    // height of each map in pixels
+		Background string // background color as hex
+		Styles     string // path to style file
+		Labels     bool   // label systems
+		Planets    bool   // label systems with the number of planets they have
+		Format     string // output format: png or svg
+		Sheet      bool   // save one contact sheet instead of a file per layer
+		Output     string // output directory
+	}
 	Server struct {
-		Host string
-		Port string
+		Host        string
+		Port        string
+		Public      string        // path to static files; embedded files are used if empty
+		ScanWorkers int           // number of scans rendered at the same time
+		TokenKey    string        // key for signing bearer tokens
+		TokenTTL    time.Duration // lifetime of bearer tokens
+		Drain       time.Duration // time to let requests finish when shutting down
+		Watch       bool          // reload the galaxy file when it changes
+	}
+	Validate struct {
+		JSON bool // write reports as JSON
 	}
-	PIDFile bool // create pid file if set
+	PIDFile bool // create pid file in the data path if set
 }
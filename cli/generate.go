@@ -0,0 +1,128 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package cli
+
+import (
+	"fmt"
+	"github.com/mdhender/lutymaps/pkg/adapters"
+	"github.com/mdhender/lutymaps/pkg/generate"
+	"github.com/mdhender/lutymaps/pkg/stores/mem"
+	"github.com/mdhender/lutymaps/pkg/validate"
+	"github.com/spf13/cobra"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var cmdGenerate = &cobra.Command{
+	Use:   "generate file",
+	Short: "Generate a new galaxy file",
+	Long: `Generate a galaxy of random systems and save it as a galaxy file.
+The same seed and options always create the same file.
+The file name is relative to the data path.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		weights, err := parseWeights(cliConfig.Generate.Kinds)
+		if err != nil {
+			log.Fatal(err)
+		}
+		options := []generate.Option{
+			generate.WithSeed(cliConfig.Generate.Seed),
+			generate.WithSize(cliConfig.Generate.Size),
+			generate.WithCount(cliConfig.Generate.Count),
+			generate.WithShape(generate.Shape(cliConfig.Generate.Shape)),
+			generate.WithArms(cliConfig.Generate.Arms),
+			generate.WithClusters(cliConfig.Generate.Clusters),
+			generate.WithMinSeparation(cliConfig.Data.MinSeparation),
+		}
+		if weights != nil {
+			options = append(options, generate.WithWeights(weights))
+		}
+		systems, err := generate.New(options...)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		mstore := mem.New()
+		if err = mstore.AddSystems(systems...); err != nil {
+			log.Fatal(err)
+		}
+		jstore, err := adapters.StoreToJSDB(mstore)
+		if err != nil {
+			log.Fatal(err)
+		}
+		path := dataFile(args[0])
+		// the generator should never break the rules, but check before saving
+		report, err := validate.Galaxy(jstore,
+			validate.WithBounds(cliConfig.Generate.Size),
+			validate.WithMinSeparation(math.Max(cliConfig.Data.MinSeparation, 1)))
+		if err != nil {
+			log.Fatal(err)
+		} else if err = report.Err(); err != nil {
+			log.Fatal(err)
+		}
+		if err = jstore.Save(path); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("generate: %q: created %d systems\n", path, len(systems))
+	},
+}
+
+func init() {
+	cmdMain.AddCommand(cmdGenerate)
+	cmdGenerate.Flags().Int64Var(&cliConfig.Generate.Seed, "seed", 1, "seed for the random number generator")
+	cmdGenerate.Flags().IntVar(&cliConfig.Generate.Size, "size", 25, "place systems within -size..size on each axis")
+	cmdGenerate.Flags().IntVar(&cliConfig.Generate.Count, "count", 10_000, "number of systems")
+	cmdGenerate.Flags().StringVar(&cliConfig.Generate.Shape, "shape", string(generate.ShapeCube), "distribution of systems (cube, sphere, disk, spiral or clustered)")
+	cmdGenerate.Flags().IntVar(&cliConfig.Generate.Arms, "arms", 2, "number of arms in a spiral")
+	cmdGenerate.Flags().IntVar(&cliConfig.Generate.Clusters, "clusters", 8, "number of clusters in a clustered galaxy")
+	cmdGenerate.Flags().StringVar(&cliConfig.Generate.Kinds, "kinds", "", `weights for kinds as "kind=weight,..." (default is the weights of the original galaxy files)`)
+}
+
+// parseWeights parses "kind=weight,kind=weight" into weights by kind.
+// It returns nil, meaning the default weights, for an empty string.
+func parseWeights(s string) (map[mem.SystemKind]int, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	weights := make(map[mem.SystemKind]int)
+	for _, field := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return nil, fmt.Errorf("kinds: %q: expected kind=weight", field)
+		}
+		kind, ok := mem.ParseSystemKind(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("kinds: unknown kind %q", strings.TrimSpace(name))
+		}
+		weight, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("kinds: %q: weight is not an integer", field)
+		}
+		weights[kind] = weight
+	}
+	return weights, nil
+}
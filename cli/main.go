@@ -27,10 +27,12 @@ package cli
 import (
 	"errors"
 	"fmt"
+	"github.com/mdhender/lutymaps/pkg/adapters"
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
@@ -43,6 +45,7 @@ const (
 
 var (
 	cliConfig Config
+	publicFS  fs.FS // static files embedded in the binary
 )
 
 // cmdMain represents the base command when called without any subcommands
@@ -62,16 +65,43 @@ var cmdMain = &cobra.Command{
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
-func Execute() {
+// The public files are served when no public directory is configured.
+func Execute(public fs.FS) {
+	var err error
+	publicFS, err = fs.Sub(public, "public")
+	cobra.CheckErr(err)
 	cobra.CheckErr(cmdMain.Execute())
 }
 
 func init() {
 	cmdMain.PersistentFlags().StringVar(&cliConfig.ConfigFile, "config", "", "config file (default is ~/."+strings.ToLower(ENV_PREFIX)+".json)")
+	cmdMain.PersistentFlags().StringVar(&cliConfig.Data.Path, "data", ".", "path to data files")
+	cmdMain.PersistentFlags().StringVar(&cliConfig.Data.Galaxy, "galaxy", "galaxy-001.json", "galaxy file (relative to the data path)")
+	cmdMain.PersistentFlags().StringVar(&cliConfig.Data.Accounts, "accounts", "accounts.json", "accounts file (relative to the data path)")
+	cmdMain.PersistentFlags().BoolVar(&cliConfig.Data.Lenient, "lenient", false, "accept unknown system kinds when loading data")
+	cmdMain.PersistentFlags().IntVar(&cliConfig.Data.Bounds, "bounds", 0, "reject galaxies with systems outside -bounds..bounds (0 is unbounded)")
+	cmdMain.PersistentFlags().Float64Var(&cliConfig.Data.MinSeparation, "min-separation", 0, "reject galaxies with systems closer than this (0 allows shared coordinates)")
 	cmdMain.PersistentFlags().BoolVar(&cliConfig.Flags.Test, "test", false, "test mode")
 	cmdMain.PersistentFlags().BoolVar(&cliConfig.Flags.Verbose, "verbose", false, "verbose mode")
 }
 
+// dataFile returns the path to a data file.
+// Relative names are resolved against the data path.
+func dataFile(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(cliConfig.Data.Path, name)
+}
+
+// loadMode returns the mode for loading data files.
+func loadMode() adapters.LoadMode {
+	if cliConfig.Data.Lenient {
+		return adapters.Lenient
+	}
+	return adapters.Strict
+}
+
 // bindConfig reads in config file and ENV variables if set.
 // logic for binding viper and cobra taken from
 // https://carolynvanslyck.com/blog/2020/08/sting-of-the-viper/
@@ -116,19 +146,35 @@ func bindConfig(cmd *cobra.Command) error {
 	viper.SetEnvPrefix(ENV_PREFIX)
 	viper.AutomaticEnv()
 
-	// bind the current command's flags to viper
+	// bind the current command's flags to viper.
+	// The command's own flags are looked up under the command's name first, e.g. scan.width,
+	// so that commands with flags of the same name can be configured separately.
+	inherited := cmd.InheritedFlags()
 	cmd.Flags().VisitAll(func(f *pflag.Flag) {
-		// Environment variables can't have dashes in them, so bind them to their equivalent
-		// keys with underscores, e.g. --favorite-color to STING_FAVORITE_COLOR
-		if strings.Contains(f.Name, "-") {
-			envVarSuffix := strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
-			_ = viper.BindEnv(f.Name, fmt.Sprintf("%s_%s", ENV_PREFIX, envVarSuffix))
+		keys := []string{f.Name}
+		if inherited.Lookup(f.Name) == nil {
+			keys = []string{cmd.Name() + "." + f.Name, f.Name}
+		}
+		for _, key := range keys {
+			// Environment variables can't have dashes or dots in them, so bind them to their equivalent
+			// keys with underscores, e.g. --favorite-color to STING_FAVORITE_COLOR
+			// and scan.tile-size to STING_SCAN_TILE_SIZE
+			if strings.ContainsAny(key, "-.") {
+				envVarSuffix := strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(key))
+				_ = viper.BindEnv(key, fmt.Sprintf("%s_%s", ENV_PREFIX, envVarSuffix))
+			}
 		}
 
 		// Apply the viper config value to the flag when the flag is not set and viper has a value
-		if !f.Changed && viper.IsSet(f.Name) {
-			val := viper.Get(f.Name)
-			_ = cmd.Flags().Set(f.Name, fmt.Sprintf("%v", val))
+		if f.Changed {
+			return
+		}
+		for _, key := range keys {
+			if viper.IsSet(key) {
+				val := viper.Get(key)
+				_ = cmd.Flags().Set(f.Name, fmt.Sprintf("%v", val))
+				return
+			}
 		}
 	})
 
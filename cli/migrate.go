@@ -0,0 +1,59 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package cli
+
+import (
+	"github.com/mdhender/lutymaps/pkg/stores/jsdb"
+	"github.com/spf13/cobra"
+	"log"
+)
+
+var cmdMigrate = &cobra.Command{
+	Use:   "migrate [file...]",
+	Short: "Upgrade data files to the current version",
+	Long: `Upgrade galaxy files in place to the current version of the file format.
+The old file is kept as a numbered backup.
+If no files are given, the galaxy file is upgraded.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			args = []string{dataFile(cliConfig.Data.Galaxy)}
+		}
+		for _, path := range args {
+			from, err := jsdb.Migrate(path)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if from == jsdb.CurrentVersion {
+				log.Printf("migrate: %q: already at version %d\n", path, from)
+				continue
+			}
+			log.Printf("migrate: %q: upgraded from version %d to %d\n", path, from, jsdb.CurrentVersion)
+		}
+	},
+}
+
+func init() {
+	cmdMain.AddCommand(cmdMigrate)
+}
@@ -0,0 +1,63 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package cli
+
+import (
+	"github.com/mdhender/lutymaps/pkg/stores/jsdb"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrateBackup(t *testing.T) {
+	dir := t.TempDir()
+	old := `{"meta":{"version":1},"systems":[{"x":1,"y":2,"z":3,"kind":"Empty"}]}`
+	if err := os.WriteFile(filepath.Join(dir, "old.json"), []byte(old), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, code := runCommand(t, dir, "migrate", "old.json"); code != 0 {
+		t.Fatalf("migrate: want exit 0: got %d", code)
+	}
+	if buf, _ := os.ReadFile(filepath.Join(dir, "old.json.1")); string(buf) != old {
+		t.Errorf("backup: want the old file: got %q", buf)
+	}
+	s, err := jsdb.New(filepath.Join(dir, "old.json"))
+	if err != nil {
+		t.Fatal(err)
+	} else if s.Meta.Version != jsdb.CurrentVersion {
+		t.Errorf("version: want %d: got %d", jsdb.CurrentVersion, s.Meta.Version)
+	}
+
+	newer := `{"meta":{"version":99},"systems":[]}`
+	if err = os.WriteFile(filepath.Join(dir, "newer.json"), []byte(newer), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, code := runCommand(t, dir, "migrate", "newer.json"); code == 0 {
+		t.Errorf("migrate newer: want non-zero exit: got 0")
+	}
+	if buf, _ := os.ReadFile(filepath.Join(dir, "newer.json")); string(buf) != newer {
+		t.Errorf("newer: file was changed: %q", buf)
+	}
+}
@@ -0,0 +1,85 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// createPIDFile writes the process id to the path.
+// It returns an error if the file names a process that is still running.
+// A file left behind by a process that has stopped is replaced.
+func createPIDFile(path string) error {
+	for attempt := 0; ; attempt++ {
+		fp, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = fmt.Fprintf(fp, "%d\n", os.Getpid())
+			if cerr := fp.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return fmt.Errorf("pid file: %w", err)
+			}
+			log.Printf("pid file: created %q\n", path)
+			return nil
+		} else if !errors.Is(err, fs.ErrExist) || attempt != 0 {
+			return fmt.Errorf("pid file: %w", err)
+		}
+
+		buf, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("pid file: %w", err)
+		}
+		if pid, err := strconv.Atoi(strings.TrimSpace(string(buf))); err == nil && pid != os.Getpid() && processRunning(pid) {
+			return fmt.Errorf("pid file: %q: process %d is still running", path, pid)
+		}
+		log.Printf("pid file: removing stale %q\n", path)
+		if err = os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("pid file: %w", err)
+		}
+	}
+}
+
+// removePIDFile removes the pid file if it still names this process.
+func removePIDFile(path string) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	if pid, err := strconv.Atoi(strings.TrimSpace(string(buf))); err != nil || pid != os.Getpid() {
+		return
+	}
+	if err = os.Remove(path); err != nil {
+		log.Printf("pid file: %v\n", err)
+		return
+	}
+	log.Printf("pid file: removed %q\n", path)
+}
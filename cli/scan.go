@@ -25,57 +25,73 @@
 package cli
 
 import (
+	"fmt"
+	gl "github.com/fogleman/fauxgl"
 	"github.com/mdhender/lutymaps/pkg/adapters"
 	"github.com/mdhender/lutymaps/pkg/scan"
 	"github.com/mdhender/lutymaps/pkg/stores/jsdb"
-	"github.com/mdhender/lutymaps/pkg/stores/mem"
 	"github.com/spf13/cobra"
+	"image"
 	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var cmdScan = &cobra.Command{
 	Use:   "scan",
-	Short: "Scan a sector to a PNG file",
-	Long:  `Create an image from a sector scan.`,
+	Short: "Scan a sector to a PNG, SVG or GIF file",
+	Long: `Create an image from a sector scan.
+The png format shades the systems; the svg and lines formats draw them
+as outlines, which stay crisp when printed.
+The gif and frames formats circle the camera around the center of the
+sector, as an animated GIF or as numbered PNG files in a directory.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		jstore, err := jsdb.New("galaxy-001.json")
+		jsPath := dataFile(cliConfig.Data.Galaxy)
+		jstore, err := jsdb.New(jsPath)
 		if err != nil {
 			log.Fatal(err)
 		}
+		if err = checkGalaxy(jsPath, jstore); err != nil {
+			log.Fatal(err)
+		}
 
-		mstore, err := adapters.JSDBToStore(jstore)
+		mstore, err := adapters.JSDBToStore(jstore, loadMode())
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		//jstore, err = adapters.StoreToJSDB(mstore)
-		//if err != nil {
-		//	log.Fatal(err)
-		//}
-		//kinds := []string{
-		//	"Blue Super Giant",
-		//	"Blue Super Giant",
-		//	"Blue Super Giant",
-		//	"Yellow Main Sequence",
-		//	"Yellow Main Sequence",
-		//	"Dense Dust Cloud",
-		//	"Medium Dust Cloud",
-		//	"Light Dust Cloud",
-		//}
-		//for i := len(jstore.Systems); i < 10_000; i++ {
-		//	jstore.Systems = append(jstore.Systems, &jsdb.System{
-		//		X:    rand.Intn(51) - 25,
-		//		Y:    rand.Intn(51) - 25,
-		//		Z:    rand.Intn(51) - 25,
-		//		Kind: kinds[rand.Intn(len(kinds))],
-		//	})
-		//}
-		//err = jstore.Save("galaxy-002.json")
-		//if err != nil {
-		//	log.Fatal(err)
-		//}
+		options, err := scanOptions(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
 
-		err = scan.New(mstore, mem.FilterBySector(0, 0, 0, 50), "scan.png")
+		systems := mstore.WithinRadius(0, 0, 0, 50)
+		switch cliConfig.Scan.Format {
+		case "png":
+			err = scan.New(systems, scanOutput("scan.png"), options...)
+		case "svg":
+			err = scan.NewSVG(systems, scanOutput("scan.svg"), options...)
+		case "lines":
+			err = scan.NewLines(systems, scanOutput("scan-lines.png"), options...)
+		case "gif":
+			err = scan.NewTurntableGIF(systems, scanOutput("scan.gif"), options...)
+		case "frames":
+			dir := scanOutput("scan-frames")
+			if err = os.MkdirAll(dir, 0755); err != nil {
+				break
+			}
+			err = scan.Turntable(systems, func(frame int, img image.Image) error {
+				return gl.SavePNG(filepath.Join(dir, fmt.Sprintf("frame-%04d.png", frame+1)), img)
+			}, options...)
+			if err == nil {
+				log.Printf("scan: %q: created %d frames\n", dir, cliConfig.Scan.Frames)
+			}
+		default:
+			err = fmt.Errorf("format: want png, svg, lines, gif or frames: got %q", cliConfig.Scan.Format)
+		}
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -98,4 +114,118 @@ var cmdScan = &cobra.Command{
 
 func init() {
 	cmdMain.AddCommand(cmdScan)
+	cmdScan.Flags().IntVar(&cliConfig.Scan.Width, "width", 3200, "output width in pixels")
+	cmdScan.Flags().IntVar(&cliConfig.Scan.Height, "height", 3200, "output height in pixels")
+	cmdScan.Flags().IntVar(&cliConfig.Scan.Supersample, "supersample", 4, "supersampling factor for antialiasing")
+	cmdScan.Flags().Float64Var(&cliConfig.Scan.Fovy, "fovy", 60, "vertical field of view in degrees")
+	cmdScan.Flags().Float64Var(&cliConfig.Scan.Near, "near", 1, "near clipping plane")
+	cmdScan.Flags().Float64Var(&cliConfig.Scan.Far, "far", 100, "far clipping plane")
+	cmdScan.Flags().StringVar(&cliConfig.Scan.Eye, "eye", "50,50,0", "camera position as x,y,z")
+	cmdScan.Flags().StringVar(&cliConfig.Scan.Center, "center", "0,0,0", "view center position as x,y,z")
+	cmdScan.Flags().StringVar(&cliConfig.Scan.Up, "up", "0,0,1", "up vector as x,y,z")
+	cmdScan.Flags().StringVar(&cliConfig.Scan.Light, "light", "0.75,0.5,1", "light direction as x,y,z")
+	cmdScan.Flags().StringVar(&cliConfig.Scan.Background, "background", "#000000", "background color as hex")
+	cmdScan.Flags().StringVar(&cliConfig.Scan.Styles, "styles", "", "JSON or YAML file with styles for system kinds")
+	cmdScan.Flags().StringVar(&cliConfig.Scan.Format, "format", "png", "output format (png, svg, lines, gif or frames)")
+	cmdScan.Flags().StringVar(&cliConfig.Scan.Output, "output", "", "output file, or directory for frames (default depends on the format)")
+	cmdScan.Flags().BoolVar(&cliConfig.Scan.Labels, "labels", false, "label systems with their name or id")
+	cmdScan.Flags().BoolVar(&cliConfig.Scan.Coordinates, "label-coordinates", false, "label systems with their coordinates instead of their name")
+	cmdScan.Flags().BoolVar(&cliConfig.Scan.Planets, "label-planets", false, "label systems with the number of planets they have")
+	cmdScan.Flags().Float64Var(&cliConfig.Scan.FontSize, "font-size", 0, "label size in pixels (0 scales with the image height)")
+	cmdScan.Flags().IntVar(&cliConfig.Scan.Grid, "grid", 10, "distance between grid lines (0 hides the grid)")
+	cmdScan.Flags().StringVar(&cliConfig.Scan.GridPlanes, "grid-planes", "xy", "grid planes as a list of xy, xz and yz")
+	cmdScan.Flags().StringVar(&cliConfig.Scan.Origin, "origin", "0,0,0", "point the axes and grid planes pass through as x,y,z")
+	cmdScan.Flags().BoolVar(&cliConfig.Scan.Axes, "axes", true, "draw the x, y and z axes with their coordinates")
+	cmdScan.Flags().IntVar(&cliConfig.Scan.Frames, "frames", 36, "number of frames in a turntable (gif and frames formats)")
+	cmdScan.Flags().Float64Var(&cliConfig.Scan.Elevation, "elevation", 0, "turntable camera elevation in degrees (default is the elevation of the eye)")
+	cmdScan.Flags().DurationVar(&cliConfig.Scan.Delay, "delay", 100*time.Millisecond, "time between turntable frames in a gif")
+	cmdScan.Flags().IntVar(&cliConfig.Scan.Workers, "workers", 0, "number of goroutines rendering tiles (0 is one per CPU)")
+	cmdScan.Flags().IntVar(&cliConfig.Scan.TileSize, "tile-size", 512, "tile width and height in pixels (0 renders the image as one tile)")
+	cmdScan.Flags().IntVar(&cliConfig.Scan.MemoryLimit, "memory-limit", 1024, "megabytes of tile buffers rendered at the same time")
+}
+
+// scanOutput returns the output file, or the default name if none was given.
+func scanOutput(name string) string {
+	if cliConfig.Scan.Output != "" {
+		return cliConfig.Scan.Output
+	}
+	return name
+}
+
+// scanOptions converts the scan flags to render options.
+func scanOptions(cmd *cobra.Command) ([]scan.Option, error) {
+	eye, err := parseVector(cliConfig.Scan.Eye)
+	if err != nil {
+		return nil, fmt.Errorf("eye: %w", err)
+	}
+	center, err := parseVector(cliConfig.Scan.Center)
+	if err != nil {
+		return nil, fmt.Errorf("center: %w", err)
+	}
+	up, err := parseVector(cliConfig.Scan.Up)
+	if err != nil {
+		return nil, fmt.Errorf("up: %w", err)
+	}
+	light, err := parseVector(cliConfig.Scan.Light)
+	if err != nil {
+		return nil, fmt.Errorf("light: %w", err)
+	}
+	origin, err := parseVector(cliConfig.Scan.Origin)
+	if err != nil {
+		return nil, fmt.Errorf("origin: %w", err)
+	}
+	var planes []scan.Plane
+	for _, plane := range strings.Split(cliConfig.Scan.GridPlanes, ",") {
+		if plane = strings.TrimSpace(plane); plane != "" {
+			planes = append(planes, scan.Plane(strings.ToLower(plane)))
+		}
+	}
+	options := []scan.Option{
+		scan.WithImageSize(cliConfig.Scan.Width, cliConfig.Scan.Height),
+		scan.WithSupersampling(cliConfig.Scan.Supersample),
+		scan.WithProjection(cliConfig.Scan.Fovy, cliConfig.Scan.Near, cliConfig.Scan.Far),
+		scan.WithCamera(eye, center, up),
+		scan.WithLight(light),
+		scan.WithBackground(gl.HexColor(cliConfig.Scan.Background)),
+		scan.WithLabels(cliConfig.Scan.Labels),
+		scan.WithCoordinateLabels(cliConfig.Scan.Coordinates),
+		scan.WithPlanetCounts(cliConfig.Scan.Planets),
+		scan.WithFontSize(cliConfig.Scan.FontSize),
+		scan.WithGrid(cliConfig.Scan.Grid, planes...),
+		scan.WithOrigin(origin),
+		scan.WithAxes(cliConfig.Scan.Axes),
+		scan.WithFrames(cliConfig.Scan.Frames),
+		scan.WithFrameDelay(cliConfig.Scan.Delay),
+		scan.WithWorkers(cliConfig.Scan.Workers),
+		scan.WithTileSize(cliConfig.Scan.TileSize),
+		scan.WithMemoryLimit(int64(cliConfig.Scan.MemoryLimit) << 20),
+	}
+	if cmd.Flags().Changed("elevation") {
+		options = append(options, scan.WithElevation(cliConfig.Scan.Elevation))
+	}
+	if cliConfig.Scan.Styles != "" {
+		styles, err := scan.LoadStyles(cliConfig.Scan.Styles)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, scan.WithStyles(styles))
+	}
+	return options, nil
+}
+
+// parseVector parses a vector from a string like "x,y,z".
+func parseVector(s string) (gl.Vector, error) {
+	fields := strings.Split(s, ",")
+	if len(fields) != 3 {
+		return gl.Vector{}, fmt.Errorf("want x,y,z: got %q", s)
+	}
+	var xyz [3]float64
+	for i, field := range fields {
+		f, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return gl.Vector{}, fmt.Errorf("want x,y,z: got %q: %w", s, err)
+		}
+		xyz[i] = f
+	}
+	return gl.V(xyz[0], xyz[1], xyz[2]), nil
 }
@@ -0,0 +1,78 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package cli
+
+import (
+	"github.com/mdhender/lutymaps/pkg/stores/jsdb"
+	"github.com/mdhender/lutymaps/pkg/stores/mem"
+	"github.com/spf13/cobra"
+	"log"
+)
+
+var cmdHashSecrets = &cobra.Command{
+	Use:   "hash-secrets",
+	Short: "Hash plain text secrets in an accounts file",
+	Long: `Replace any plain text secrets in an accounts file with hashed secrets.
+Secrets that are already hashed are not changed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		jsPath := dataFile(cliConfig.Data.Accounts)
+		// keep other processes from saving the accounts between the load and the save
+		unlock, err := jsdb.Lock(jsPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer unlock()
+		jsAccts := jsdb.AccountStore{}
+		if err := jsAccts.Load(jsPath); err != nil {
+			log.Fatal(err)
+		}
+
+		hashed := 0
+		for _, acct := range jsAccts.Accounts {
+			if mem.IsHashedSecret(acct.Secret) {
+				continue
+			}
+			secret, err := mem.HashSecret(acct.Secret)
+			if err != nil {
+				log.Fatalf("hash-secrets: account %q: %v\n", acct.Id, err)
+			}
+			acct.Secret = secret
+			hashed++
+		}
+		if hashed == 0 {
+			log.Printf("hash-secrets: %q: no plain text secrets\n", jsPath)
+			return
+		}
+
+		if err := jsAccts.Save(jsPath); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("hash-secrets: %q: hashed %d secrets\n", jsPath, hashed)
+	},
+}
+
+func init() {
+	cmdMain.AddCommand(cmdHashSecrets)
+}
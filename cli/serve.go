@@ -25,14 +25,25 @@
 package cli
 
 import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
 	"github.com/mdhender/lutymaps/pkg/adapters"
 	"github.com/mdhender/lutymaps/pkg/server"
 	"github.com/mdhender/lutymaps/pkg/stores/jsdb"
+	"github.com/mdhender/lutymaps/pkg/stores/mem"
+	"github.com/mdhender/lutymaps/pkg/tokens"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
+	"io/fs"
 	"log"
 	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 )
 
 var cmdServe = &cobra.Command{
@@ -40,49 +51,229 @@ var cmdServe = &cobra.Command{
 	Short: "Serve data for the engine",
 	Long:  `Provide a REST-ish API for engine data.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		jsPath := "galaxy-001.json"
-		jstore, err := jsdb.New(jsPath)
-		if err != nil {
+		if err := serve(); err != nil {
 			log.Fatal(err)
 		}
-		log.Printf("serve: loaded %q\n", jsPath)
-		jsPath = "accounts.json"
-		jsAccts := jsdb.AccountStore{}
-		if err = jsAccts.Load(jsPath); err != nil {
-			log.Fatal(err)
+	},
+}
+
+// serve runs the server until it is shut down by a signal.
+// It returns an error if the server can't start or stops on its own.
+func serve() error {
+	mstore, err := loadStore()
+	if err != nil {
+		return err
+	}
+
+	tokenKey := []byte(cliConfig.Server.TokenKey)
+	if len(tokenKey) == 0 {
+		// tokens signed with a random key are invalidated when the server restarts
+		log.Printf("serve: token-key is not set: using a random key\n")
+		tokenKey = make([]byte, tokens.MinKeyLength)
+		if _, err = rand.Read(tokenKey); err != nil {
+			return err
+		}
+	}
+	tstore, err := tokens.New(tokenKey, cliConfig.Server.TokenTTL)
+	if err != nil {
+		return err
+	}
+	// the galaxy and accounts are only read, so the revoked tokens are the only
+	// state to keep across restarts. they are useless with a random key.
+	persist := func() error { return nil }
+	if len(cliConfig.Server.TokenKey) != 0 {
+		revokedFile := dataFile(revokedFileName)
+		if err = loadRevoked(revokedFile, tstore); err != nil {
+			return err
 		}
-		log.Printf("serve: loaded %q\n", jsPath)
+		persist = func() error {
+			return saveRevoked(revokedFile, tstore)
+		}
+	}
+
+	var options []server.Option
+	options = append(options, server.WithStore(mstore))
+	options = append(options, server.WithTokens(tstore))
+	if cliConfig.Server.Public != "" {
+		options = append(options, server.WithPublicDir(cliConfig.Server.Public))
+	} else {
+		options = append(options, server.WithPublicFS(publicFS))
+	}
+	options = append(options, server.WithScanWorkers(cliConfig.Server.ScanWorkers))
 
-		mstore, err := adapters.JSDBToStore(jstore)
+	s, err := server.New(options...)
+	if err != nil {
+		return err
+	}
+
+	if cliConfig.PIDFile {
+		pidFile := dataFile("lutymaps.pid")
+		if err = createPIDFile(pidFile); err != nil {
+			return err
+		}
+		defer removePIDFile(pidFile)
+	}
+
+	// reload replaces the server's store with freshly loaded data.
+	// The current data is kept if the new data can't be loaded.
+	var reloadLock sync.Mutex
+	reload := func(reason string) {
+		reloadLock.Lock()
+		defer reloadLock.Unlock()
+		log.Printf("server: %s: reloading data\n", reason)
+		mstore, err := loadStore()
 		if err != nil {
-			log.Fatal(err)
+			log.Printf("server: reload: %v: keeping current data\n", err)
+			return
 		}
-		log.Printf("serve: adapted galaxy store\n")
-		mstore.Accounts, err = adapters.JSAccountsToMemAccounts(jsAccts)
+		s.SwapStore(mstore)
+		log.Printf("server: reload: done\n")
+	}
+
+	if cliConfig.Server.Watch {
+		galaxyFile := dataFile(cliConfig.Data.Galaxy)
+		stopWatching, err := watchFile(galaxyFile, func() {
+			reload(fmt.Sprintf("%q changed", galaxyFile))
+		})
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
-		log.Printf("serve: adapted accounts store\n")
+		defer stopWatching()
+	}
 
-		var options []server.Option
-		options = append(options, server.WithAuthentication(mstore))
-		options = append(options, server.WithAuthorization(mstore))
+	srv := &http.Server{
+		Addr:              net.JoinHostPort(cliConfig.Server.Host, cliConfig.Server.Port),
+		Handler:           s.Routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      5 * time.Minute, // scans can take a while to render
+		IdleTimeout:       2 * time.Minute,
+	}
 
-		s, err := server.New(options...)
-		if err != nil {
-			log.Fatal(err)
+	// listen for signals before starting the server so that none are missed
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	errc := make(chan error, 1)
+	go func() {
+		log.Printf("server: listening on %q\n", srv.Addr)
+		errc <- srv.ListenAndServe()
+	}()
+
+	for {
+		select {
+		case err = <-errc:
+			if errors.Is(err, http.ErrServerClosed) {
+				log.Printf("server: %v\n", err)
+				return nil
+			}
+			return fmt.Errorf("server: %w", err)
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				reload(sig.String())
+				continue
+			}
+			log.Printf("server: %v: shutting down (waiting up to %v)\n", sig, cliConfig.Server.Drain)
+			ctx, cancel := context.WithTimeout(context.Background(), cliConfig.Server.Drain)
+			err = srv.Shutdown(ctx)
+			cancel()
+			if err != nil {
+				// cut off the requests that didn't finish in time
+				log.Printf("server: shutdown: %v: closing connections\n", err)
+				if cerr := srv.Close(); cerr != nil {
+					log.Printf("server: close: %v\n", cerr)
+				}
+			}
+			// save even if requests were cut off so that no revocations are lost
+			if perr := persist(); perr != nil {
+				if err == nil {
+					err = perr
+				} else {
+					log.Printf("server: %v\n", perr)
+				}
+			}
+			if err != nil {
+				return fmt.Errorf("server: shutdown: %w", err)
+			}
+			log.Printf("server: shutdown: done\n")
+			return nil
 		}
-		router := s.Routes()
+	}
+}
 
-		log.Printf("server: listening on %q\n", net.JoinHostPort(cliConfig.Server.Host, cliConfig.Server.Port))
-		log.Fatal(http.ListenAndServe(net.JoinHostPort(cliConfig.Server.Host, cliConfig.Server.Port), router))
-	},
+// loadStore loads the galaxy and accounts files into a new store.
+func loadStore() (*mem.Store, error) {
+	jsPath := dataFile(cliConfig.Data.Galaxy)
+	jstore, err := jsdb.New(jsPath)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("serve: loaded %q\n", jsPath)
+	if err = checkGalaxy(jsPath, jstore); err != nil {
+		return nil, err
+	}
+	jsPath = dataFile(cliConfig.Data.Accounts)
+	jsAccts := jsdb.AccountStore{}
+	if err = jsAccts.Load(jsPath); err != nil {
+		return nil, err
+	}
+	log.Printf("serve: loaded %q\n", jsPath)
+
+	mstore, err := adapters.JSDBToStore(jstore, loadMode())
+	if err != nil {
+		return nil, err
+	}
+	if mstore.SystemCount() == 0 {
+		// most likely a file that was caught in the middle of being written
+		return nil, fmt.Errorf("%q: no systems", dataFile(cliConfig.Data.Galaxy))
+	}
+	log.Printf("serve: adapted galaxy store\n")
+	accts, err := adapters.JSAccountsToMemAccounts(jsAccts)
+	if err != nil {
+		return nil, err
+	}
+	mstore.SetAccounts(accts)
+	log.Printf("serve: adapted accounts store\n")
+	return mstore, nil
+}
+
+// revokedFileName is the file in the data path that holds the revoked tokens.
+const revokedFileName = "revoked.json"
+
+// loadRevoked restores the revoked tokens saved by an earlier server.
+// A missing file means that no tokens were revoked.
+func loadRevoked(path string, tstore *tokens.Store) error {
+	var revoked jsdb.RevokedStore
+	if err := revoked.Load(path); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	tstore.Restore(revoked.Tokens)
+	log.Printf("serve: loaded %q\n", path)
+	return nil
+}
+
+// saveRevoked saves the revoked tokens that haven't expired.
+func saveRevoked(path string, tstore *tokens.Store) error {
+	revoked := jsdb.RevokedStore{Tokens: tstore.Revoked()}
+	if err := revoked.Save(path); err != nil {
+		return err
+	}
+	log.Printf("server: saved %d revoked tokens to %q\n", len(revoked.Tokens), path)
+	return nil
 }
 
 func init() {
 	cmdMain.AddCommand(cmdServe)
 	cmdServe.Flags().StringVar(&cliConfig.Server.Host, "host", "", "interface to run server on")
-	_ = viper.BindPFlag("host", cmdServe.Flags().Lookup("host"))
 	cmdServe.Flags().StringVarP(&cliConfig.Server.Port, "port", "p", "3000", "port to run server on")
-	_ = viper.BindPFlag("port", cmdServe.Flags().Lookup("port"))
+	cmdServe.Flags().StringVar(&cliConfig.Server.Public, "public", "", "path to static files (default is the files embedded in the binary)")
+	cmdServe.Flags().IntVar(&cliConfig.Server.ScanWorkers, "scan-workers", 2, "number of scans rendered at the same time")
+	cmdServe.Flags().StringVar(&cliConfig.Server.TokenKey, "token-key", "", fmt.Sprintf("key for signing bearer tokens (at least %d bytes)", tokens.MinKeyLength))
+	cmdServe.Flags().DurationVar(&cliConfig.Server.TokenTTL, "token-ttl", 24*time.Hour, "lifetime of bearer tokens")
+	cmdServe.Flags().DurationVar(&cliConfig.Server.Drain, "drain", 30*time.Second, "time to let requests finish when shutting down")
+	cmdServe.Flags().BoolVar(&cliConfig.Server.Watch, "watch", true, "reload the galaxy file when it changes")
+	cmdServe.Flags().BoolVar(&cliConfig.PIDFile, "pid-file", false, "create lutymaps.pid in the data path while the server runs")
 }
@@ -0,0 +1,182 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	gl "github.com/fogleman/fauxgl"
+	"github.com/mdhender/lutymaps/pkg/adapters"
+	"github.com/mdhender/lutymaps/pkg/scan"
+	"github.com/mdhender/lutymaps/pkg/stores/jsdb"
+	"github.com/mdhender/lutymaps/pkg/stores/mem"
+	"github.com/spf13/cobra"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var cmdSlices = &cobra.Command{
+	Use:   "slices",
+	Short: "Map a sector one layer at a time",
+	Long: `Cut a sector into layers along an axis and create a top-down map of each layer.
+The maps are saved as numbered files in the output directory, starting
+with the lowest layer, or as a single contact sheet.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		jsPath := dataFile(cliConfig.Data.Galaxy)
+		jstore, err := jsdb.New(jsPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err = checkGalaxy(jsPath, jstore); err != nil {
+			log.Fatal(err)
+		}
+		mstore, err := adapters.JSDBToStore(jstore, loadMode())
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		options := []scan.Option{
+			scan.WithImageSize(cliConfig.Slices.Width, cliConfig.Slices.Height),
+			scan.WithBackground(gl.HexColor(cliConfig.Slices.Background)),
+			scan.WithLabels(cliConfig.Slices.Labels),
+			scan.WithPlanetCounts(cliConfig.Slices.Planets),
+			scan.WithSliceAxis(scan.Axis(cliConfig.Slices.Axis)),
+			scan.WithSliceThickness(cliConfig.Slices.Thickness),
+		}
+		var systems mem.Systems
+		if cliConfig.Slices.Box == "" {
+			systems = mstore.Snapshot()
+		} else {
+			c, err := parseInts(cliConfig.Slices.Box, 6)
+			if err != nil {
+				log.Fatalf("box: %v\n", err)
+			}
+			systems = mstore.InBox(c[0], c[1], c[2], c[3], c[4], c[5])
+			options = append(options, scan.WithSliceBounds(c[0], c[1], c[2], c[3], c[4], c[5]))
+		}
+		if cliConfig.Slices.Styles != "" {
+			styles, err := scan.LoadStyles(cliConfig.Slices.Styles)
+			if err != nil {
+				log.Fatal(err)
+			}
+			options = append(options, scan.WithStyles(styles))
+		}
+		if cliConfig.Slices.Format != "png" && cliConfig.Slices.Format != "svg" {
+			log.Fatalf("format: want png or svg: got %q\n", cliConfig.Slices.Format)
+		}
+
+		slices, err := scan.Slices(systems, options...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(slices) == 0 {
+			log.Fatalf("slices: no systems to map\n")
+		}
+		if err = os.MkdirAll(cliConfig.Slices.Output, 0755); err != nil {
+			log.Fatal(err)
+		}
+
+		if cliConfig.Slices.Sheet {
+			path := filepath.Join(cliConfig.Slices.Output, "sheet."+cliConfig.Slices.Format)
+			if cliConfig.Slices.Format == "svg" {
+				err = createFile(path, func(w io.Writer) error { return scan.WriteContactSheetSVG(w, slices) })
+			} else {
+				err = gl.SavePNG(path, scan.ContactSheet(slices))
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+			log.Printf("slices: %q: %d layers\n", path, len(slices))
+			return
+		}
+		for i, s := range slices {
+			path := filepath.Join(cliConfig.Slices.Output, fmt.Sprintf("slice-%04d.%s", i+1, cliConfig.Slices.Format))
+			if cliConfig.Slices.Format == "svg" {
+				err = createFile(path, s.WriteSVG)
+			} else {
+				err = gl.SavePNG(path, s.Image())
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+			log.Printf("slices: %q: %s = %d..%d: %d systems\n", path, s.Axis, s.From, s.To, s.Systems)
+		}
+	},
+}
+
+func init() {
+	cmdMain.AddCommand(cmdSlices)
+	cmdSlices.Flags().StringVar(&cliConfig.Slices.Axis, "axis", "z", "axis to slice along (x, y or z)")
+	cmdSlices.Flags().IntVar(&cliConfig.Slices.Thickness, "thickness", 1, "number of coordinates in each layer")
+	cmdSlices.Flags().StringVar(&cliConfig.Slices.Box, "box", "", "sector to slice as x1,y1,z1,x2,y2,z2 (default is all systems)")
+	cmdSlices.Flags().IntVar(&cliConfig.Slices.Width, "width", 800, "width of each map in pixels")
+	cmdSlices.Flags().IntVar(&cliConfig.Slices.Height, "height", 800, "height of each map in pixels")
+	cmdSlices.Flags().StringVar(&cliConfig.Slices.Background, "background", "#000000", "background color as hex")
+	cmdSlices.Flags().StringVar(&cliConfig.Slices.Styles, "styles", "", "JSON or YAML file with styles for system kinds")
+	cmdSlices.Flags().BoolVar(&cliConfig.Slices.Labels, "labels", false, "label systems with their name or id")
+	cmdSlices.Flags().BoolVar(&cliConfig.Slices.Planets, "label-planets", false, "label systems with the number of planets they have")
+	cmdSlices.Flags().StringVar(&cliConfig.Slices.Format, "format", "png", "output format (png or svg)")
+	cmdSlices.Flags().BoolVar(&cliConfig.Slices.Sheet, "sheet", false, "save all the layers in one contact sheet")
+	cmdSlices.Flags().StringVar(&cliConfig.Slices.Output, "output", "slices", "directory for the maps")
+}
+
+// parseInts parses n comma separated integers.
+func parseInts(s string, n int) ([]int, error) {
+	fields := strings.Split(s, ",")
+	if len(fields) != n {
+		return nil, fmt.Errorf("want %d integers: got %q", n, s)
+	}
+	values := make([]int, n)
+	for i, field := range fields {
+		v, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, fmt.Errorf("want %d integers: got %q: %w", n, s, err)
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// createFile creates the file and calls write to fill it.
+func createFile(path string, write func(w io.Writer) error) error {
+	fp, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(fp)
+	if err = write(w); err != nil {
+		_ = fp.Close()
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		_ = fp.Close()
+		return err
+	}
+	return fp.Close()
+}
@@ -0,0 +1,118 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mdhender/lutymaps/pkg/stores/jsdb"
+	"github.com/mdhender/lutymaps/pkg/validate"
+	"github.com/spf13/cobra"
+	"log"
+	"os"
+)
+
+var cmdValidate = &cobra.Command{
+	Use:   "validate [file...]",
+	Short: "Check galaxy files for problems",
+	Long: `Check galaxy files for duplicate coordinates, systems out of bounds,
+unknown kinds and systems that are too close together.
+If no files are given, the galaxy file is checked.
+Files that can't be loaded are reported with a "load" error.
+Exits with a non-zero status if any file has errors.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			args = []string{dataFile(cliConfig.Data.Galaxy)}
+		}
+		type fileReport struct {
+			File string `json:"file"`
+			*validate.Report
+		}
+		var reports []fileReport
+		hasErrors := false
+		for _, path := range args {
+			jstore, err := jsdb.New(path)
+			if err != nil {
+				reports = append(reports, fileReport{File: path, Report: validate.LoadError(err)})
+				hasErrors = true
+				continue
+			}
+			report, err := validate.Galaxy(jstore, validateOptions()...)
+			if err != nil {
+				log.Fatal(err)
+			}
+			reports = append(reports, fileReport{File: path, Report: report})
+			hasErrors = hasErrors || report.HasErrors()
+		}
+
+		if cliConfig.Validate.JSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(reports); err != nil {
+				log.Fatal(err)
+			}
+		} else {
+			for _, r := range reports {
+				for _, p := range r.Problems {
+					fmt.Printf("%s: %s: %s: %s\n", r.File, p.Severity, p.Code, p.Message)
+				}
+				fmt.Printf("%s: %d systems: %d errors: %d warnings\n", r.File, r.Systems, r.Errors, r.Warnings)
+			}
+		}
+		if hasErrors {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	cmdMain.AddCommand(cmdValidate)
+	cmdValidate.Flags().BoolVar(&cliConfig.Validate.JSON, "json", false, "write the reports as JSON")
+}
+
+// validateOptions converts the data flags to validation rules.
+func validateOptions() []validate.Option {
+	return []validate.Option{
+		validate.WithBounds(cliConfig.Data.Bounds),
+		validate.WithMinSeparation(cliConfig.Data.MinSeparation),
+		validate.WithLenient(cliConfig.Data.Lenient),
+	}
+}
+
+// checkGalaxy validates a galaxy before it is used.
+// Warnings are logged; errors are returned.
+func checkGalaxy(path string, jstore *jsdb.Store) error {
+	report, err := validate.Galaxy(jstore, validateOptions()...)
+	if err != nil {
+		return err
+	}
+	if report.Warnings != 0 {
+		log.Printf("%s: %d warnings: run validate for details\n", path, report.Warnings)
+	}
+	if err = report.Err(); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
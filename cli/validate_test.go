@@ -0,0 +1,114 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain runs the command line in the arguments after "--" when the test binary
+// is started by runCommand, so that tests can check the exit status.
+func TestMain(m *testing.M) {
+	if args := os.Getenv("LUTYMAPS_TEST_ARGS"); args != "" {
+		cmdMain.SetArgs(strings.Split(args, "\n"))
+		if err := cmdMain.Execute(); err != nil {
+			os.Exit(2)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runCommand runs the command line in a new process in dir and returns its output and exit code.
+func runCommand(t *testing.T, dir string, args ...string) (stdout string, code int) {
+	t.Helper()
+	args = append([]string{"--config", filepath.Join(dir, "config.json")}, args...)
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "LUTYMAPS_TEST_ARGS="+strings.Join(args, "\n"))
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return string(out), exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatalf("run %v: %v", args, err)
+	}
+	return string(out), 0
+}
+
+func TestValidateExitCode(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"good.json":      `{"meta":{"version":3},"systems":[{"id":1,"x":0,"y":0,"z":0,"kind":"Empty"}]}`,
+		"duplicate.json": `{"meta":{"version":3},"systems":[{"id":1,"x":0,"y":0,"z":0,"kind":"Empty"},{"id":1,"x":1,"y":0,"z":0,"kind":"Empty"}]}`,
+		"broken.json":    `{"meta":`,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		file      string
+		wantExit  int
+		wantCodes string
+	}{
+		{"good.json", 0, ""},
+		{"duplicate.json", 1, "duplicate-id"},
+		{"broken.json", 1, "load"},
+	} {
+		out, code := runCommand(t, dir, "validate", "--json", tc.file)
+		if code != tc.wantExit {
+			t.Errorf("%s: want exit %d: got %d", tc.file, tc.wantExit, code)
+		}
+		var reports []struct {
+			File     string `json:"file"`
+			Errors   int    `json:"errors"`
+			Problems []struct {
+				Code string `json:"code"`
+			} `json:"problems"`
+		}
+		if err := json.Unmarshal([]byte(out), &reports); err != nil {
+			t.Fatalf("%s: report: %v: %q", tc.file, err, out)
+		}
+		if len(reports) != 1 || reports[0].File != tc.file {
+			t.Fatalf("%s: want one report for the file: got %+v", tc.file, reports)
+		}
+		var codes []string
+		for _, p := range reports[0].Problems {
+			codes = append(codes, p.Code)
+		}
+		if strings.Join(codes, ",") != tc.wantCodes {
+			t.Errorf("%s: want problems %q: got %q", tc.file, tc.wantCodes, codes)
+		}
+	}
+}
@@ -26,14 +26,22 @@
 package main
 
 import (
+	"embed"
 	"github.com/mdhender/lutymaps/cli"
 	"math/rand"
 	"time"
 )
 
+// public holds the static files for the web client.
+// The test data in public/data is deliberately left out.
+//
+//go:embed public/*.html public/*.ico public/*.png public/*.txt public/*.xml public/*.webmanifest
+//go:embed public/css public/img public/js
+var public embed.FS
+
 func main() {
 	rand.Seed(time.Now().UnixNano())
 
 	// run the command
-	cli.Execute()
+	cli.Execute(public)
 }
@@ -25,15 +25,20 @@
 package adapters
 
 import (
+	"fmt"
 	"github.com/mdhender/lutymaps/pkg/stores/jsdb"
 	"github.com/mdhender/lutymaps/pkg/stores/mem"
 	"sort"
 )
 
-// JSAccountsToMemAccounts converts JSON accounts to in-memory accounts
+// JSAccountsToMemAccounts converts JSON accounts to in-memory accounts.
+// It returns an error if any secret has not been hashed.
 func JSAccountsToMemAccounts(js jsdb.AccountStore) (mem.Accounts, error) {
 	accts := make(map[string]mem.Account)
 	for _, acct := range js.Accounts {
+		if !mem.IsHashedSecret(acct.Secret) {
+			return nil, fmt.Errorf("adapters: account %q: secret is not hashed", acct.Id)
+		}
 		a := mem.Account{
 			Id:           acct.Id,
 			UserId:       acct.UserId,
@@ -69,29 +74,64 @@ func MemAccountsToJSAccounts(ms mem.Accounts) (*jsdb.AccountStore, error) {
 	return js, nil
 }
 
+// LoadMode controls how JSDBToStore handles systems with unknown kinds.
+type LoadMode int
+
+const (
+	// Strict returns an error for the first system with an unknown kind or a missing id.
+	Strict LoadMode = iota
+	// Lenient registers unknown kinds with the store so that they survive a round trip
+	// and gives systems without an id the next free id.
+	Lenient
+)
+
 // JSDBToStore converts a JSDB store to an in-memory store.
-func JSDBToStore(store *jsdb.Store) (*mem.Store, error) {
-	s := &mem.Store{}
+func JSDBToStore(store *jsdb.Store, mode LoadMode) (*mem.Store, error) {
+	s := mem.New()
 	if store == nil {
 		return s, nil
 	}
-	for _, from := range store.Systems {
-		to := &mem.System{X: from.X, Y: from.Y, Z: from.Z}
-		switch from.Kind {
-		case "Empty":
-			to.Kind = mem.SKEmpty
-		case "Blue Super Giant":
-			to.Kind = mem.SKBlueSuperGiant
-		case "Dense Dust Cloud":
-			to.Kind = mem.SKDenseDustCloud
-		case "Medium Dust Cloud":
-			to.Kind = mem.SKMediumDustCloud
-		case "Yellow Main Sequence":
-			to.Kind = mem.SKYellowMainSequence
-		default:
-			to.Kind = mem.SKEmpty
+	systems := make([]mem.System, 0, len(store.Systems))
+	for i, from := range store.Systems {
+		if from.Id == 0 && mode == Strict {
+			return nil, fmt.Errorf("adapters: system %d: missing id", i)
+		}
+		to := mem.System{Id: from.Id, Name: from.Name, X: from.X, Y: from.Y, Z: from.Z}
+		kind, ok := mem.ParseSystemKind(from.Kind)
+		if !ok {
+			if mode == Strict {
+				return nil, fmt.Errorf("adapters: system %d: unknown kind %q", i, from.Kind)
+			}
+			var err error
+			if kind, err = s.RegisterSystemKind(from.Kind); err != nil {
+				return nil, fmt.Errorf("adapters: system %d: %w", i, err)
+			}
+		}
+		to.Kind = kind
+		for _, planet := range from.Planets {
+			if planet == nil {
+				continue
+			}
+			pk, ok := mem.ParsePlanetKind(planet.Kind)
+			if !ok {
+				// planet kinds are fixed, so neither mode can keep an unknown one
+				return nil, fmt.Errorf("adapters: system %d: orbit %d: unknown planet kind %q", i, planet.Orbit, planet.Kind)
+			}
+			to.Planets = append(to.Planets, mem.Planet{
+				Orbit:        planet.Orbit,
+				Kind:         pk,
+				Habitability: planet.Habitability,
+				Resources: mem.Resources{
+					Metals:    planet.Resources.Metals,
+					NonMetals: planet.Resources.NonMetals,
+					Fuel:      planet.Resources.Fuel,
+				},
+			})
 		}
-		s.Systems = append(s.Systems, to)
+		systems = append(systems, to)
+	}
+	if err := s.AddSystems(systems...); err != nil {
+		return nil, fmt.Errorf("adapters: %w", err)
 	}
 	return s, nil
 }
@@ -99,25 +139,26 @@ func JSDBToStore(store *jsdb.Store) (*mem.Store, error) {
 // StoreToJSDB converts an in-memory store to a JSDB store.
 func StoreToJSDB(s *mem.Store) (*jsdb.Store, error) {
 	store := &jsdb.Store{}
-	store.Meta.Version = 1
+	store.Meta.Version = jsdb.CurrentVersion
 	if s == nil {
 		return store, nil
 	}
-	for _, from := range s.Systems {
-		to := &jsdb.System{X: from.X, Y: from.Y, Z: from.Z}
-		switch from.Kind {
-		case mem.SKEmpty:
-			to.Kind = "Empty"
-		case mem.SKBlueSuperGiant:
-			to.Kind = "Blue Super Giant"
-		case mem.SKDenseDustCloud:
-			to.Kind = "Dense Dust Cloud"
-		case mem.SKMediumDustCloud:
-			to.Kind = "Medium Dust Cloud"
-		case mem.SKYellowMainSequence:
-			to.Kind = "Yellow Main Sequence"
-		default:
-			to.Kind = ""
+	for i, from := range s.Snapshot() {
+		to := &jsdb.System{Id: from.Id, Name: from.Name, X: from.X, Y: from.Y, Z: from.Z, Kind: s.SystemKindName(from.Kind)}
+		if to.Kind == "" {
+			return nil, fmt.Errorf("adapters: system %d: unknown kind %d", i, from.Kind)
+		}
+		for _, planet := range from.Planets {
+			to.Planets = append(to.Planets, &jsdb.Planet{
+				Orbit:        planet.Orbit,
+				Kind:         planet.Kind.String(),
+				Habitability: planet.Habitability,
+				Resources: jsdb.Resources{
+					Metals:    planet.Resources.Metals,
+					NonMetals: planet.Resources.NonMetals,
+					Fuel:      planet.Resources.Fuel,
+				},
+			})
 		}
 		store.Systems = append(store.Systems, to)
 	}
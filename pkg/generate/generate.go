@@ -0,0 +1,224 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+// Package generate implements a procedural galaxy generator.
+//
+// Generated galaxies are reproducible: the same seed and options
+// always produce the same systems in the same order.
+package generate
+
+import (
+	"fmt"
+	"github.com/mdhender/lutymaps/pkg/stores/mem"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Shape is how systems are distributed in the galaxy.
+type Shape string
+
+const (
+	ShapeCube      Shape = "cube"
+	ShapeSphere    Shape = "sphere"
+	ShapeDisk      Shape = "disk"
+	ShapeSpiral    Shape = "spiral"
+	ShapeClustered Shape = "clustered"
+)
+
+// New returns the systems for a new galaxy.
+// Systems are numbered from 1 in the order they are generated.
+func New(opts ...Option) ([]mem.System, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, fmt.Errorf("generate: %w", err)
+		}
+	}
+	// the weights are checked again in case the defaults are wrong
+	if err := validateWeights(o.weights); err != nil {
+		return nil, fmt.Errorf("generate: %w", err)
+	}
+
+	g := &generator{
+		options: o,
+		rnd:     rand.New(rand.NewSource(o.seed)),
+	}
+	// sort the kinds so that map order doesn't change the output
+	for kind, weight := range o.weights {
+		if weight > 0 {
+			g.kinds = append(g.kinds, kind)
+		}
+	}
+	sort.Slice(g.kinds, func(i, j int) bool { return g.kinds[i] < g.kinds[j] })
+	for _, kind := range g.kinds {
+		g.total += o.weights[kind]
+		g.cumulative = append(g.cumulative, g.total)
+	}
+	if o.shape == ShapeClustered {
+		// centers are kept away from the edges so clusters aren't cut off
+		for i := 0; i < o.clusters; i++ {
+			g.centers = append(g.centers, g.inSphere(0.75*float64(o.size)))
+		}
+	}
+
+	systems := make([]mem.System, 0, o.count)
+	for id := 1; id <= o.count; id++ {
+		p, ok := g.place()
+		if !ok {
+			return nil, fmt.Errorf("generate: system %d: no room after %d attempts: use a larger size, fewer systems or a smaller separation", id, maxAttempts)
+		}
+		systems = append(systems, mem.System{Id: id, X: p[0], Y: p[1], Z: p[2], Kind: g.kind()})
+	}
+	return systems, nil
+}
+
+// maxAttempts is the number of points tried for a system before giving up.
+const maxAttempts = 100
+
+// place returns a random point that is far enough from the points already placed.
+// It returns false if no such point is found.
+func (g *generator) place() ([3]int, bool) {
+	if g.cells == nil {
+		g.cells = make(map[[3]int][][3]int)
+		g.cellSize = int(math.Ceil(g.spacing))
+	}
+	limit := g.spacing * g.spacing
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		x, y, z := g.point()
+		p := [3]int{g.clamp(x), g.clamp(y), g.clamp(z)}
+		c := g.cell(p)
+		ok := true
+		// cells are at least as wide as the separation, so only neighboring cells need to be checked
+		for dx := -1; ok && dx <= 1; dx++ {
+			for dy := -1; ok && dy <= 1; dy++ {
+				for dz := -1; ok && dz <= 1; dz++ {
+					for _, q := range g.cells[[3]int{c[0] + dx, c[1] + dy, c[2] + dz}] {
+						ddx, ddy, ddz := float64(p[0]-q[0]), float64(p[1]-q[1]), float64(p[2]-q[2])
+						if ddx*ddx+ddy*ddy+ddz*ddz < limit {
+							ok = false
+							break
+						}
+					}
+				}
+			}
+		}
+		if ok {
+			g.cells[c] = append(g.cells[c], p)
+			return p, true
+		}
+	}
+	return [3]int{}, false
+}
+
+// cell returns the cell that contains the point.
+func (g *generator) cell(p [3]int) [3]int {
+	var c [3]int
+	for i, n := range p {
+		c[i] = n / g.cellSize
+		if n%g.cellSize != 0 && n < 0 {
+			c[i]--
+		}
+	}
+	return c
+}
+
+// generator holds the state for one galaxy.
+type generator struct {
+	*options
+	rnd        *rand.Rand
+	kinds      []mem.SystemKind    // kinds with a positive weight, in order
+	total      int                 // sum of the weights
+	cumulative []int               // running total of the weights, by kind
+	centers    [][3]float64        // cluster centers
+	cells      map[[3]int][][3]int // placed points by cell
+	cellSize   int                 // width of a cell
+}
+
+// kind returns a random kind, chosen by weight.
+// The first kind whose running total is above the random number is chosen;
+// the weights were validated, so there always is one.
+func (g *generator) kind() mem.SystemKind {
+	n := g.rnd.Intn(g.total)
+	return g.kinds[sort.SearchInts(g.cumulative, n+1)]
+}
+
+// point returns a random point for the shape.
+func (g *generator) point() (x, y, z float64) {
+	size := float64(g.size)
+	switch g.shape {
+	case ShapeSphere:
+		p := g.inSphere(size)
+		return p[0], p[1], p[2]
+	case ShapeDisk:
+		// uniform over the area of the disk, thin along the z axis
+		r := size * math.Sqrt(g.rnd.Float64())
+		theta := 2 * math.Pi * g.rnd.Float64()
+		return r * math.Cos(theta), r * math.Sin(theta), g.rnd.NormFloat64() * size / 20
+	case ShapeSpiral:
+		// arms wind half a turn from the core to the rim
+		arm := g.rnd.Intn(g.arms)
+		d := g.rnd.Float64()
+		theta := 2*math.Pi*float64(arm)/float64(g.arms) + math.Pi*d + g.rnd.NormFloat64()*0.2
+		r := size * d
+		x = r*math.Cos(theta) + g.rnd.NormFloat64()*size/40
+		y = r*math.Sin(theta) + g.rnd.NormFloat64()*size/40
+		// the core is thicker than the arms
+		z = g.rnd.NormFloat64() * size / 20 * (1.5 - d)
+		return x, y, z
+	case ShapeClustered:
+		c := g.centers[g.rnd.Intn(len(g.centers))]
+		sigma := size / 8
+		return c[0] + g.rnd.NormFloat64()*sigma, c[1] + g.rnd.NormFloat64()*sigma, c[2] + g.rnd.NormFloat64()*sigma
+	}
+	// ShapeCube: every coordinate is equally likely, like the original galaxy files
+	side := 2*g.size + 1
+	return float64(g.rnd.Intn(side) - g.size), float64(g.rnd.Intn(side) - g.size), float64(g.rnd.Intn(side) - g.size)
+}
+
+// inSphere returns a random point inside the sphere of radius r around the origin.
+func (g *generator) inSphere(r float64) [3]float64 {
+	for {
+		x, y, z := g.uniform(r), g.uniform(r), g.uniform(r)
+		if x*x+y*y+z*z <= r*r {
+			return [3]float64{x, y, z}
+		}
+	}
+}
+
+// uniform returns a random number in -r..r.
+func (g *generator) uniform(r float64) float64 {
+	return r * (2*g.rnd.Float64() - 1)
+}
+
+// clamp rounds the coordinate and limits it to -size..size.
+func (g *generator) clamp(v float64) int {
+	n := int(math.Round(v))
+	if n < -g.size {
+		return -g.size
+	} else if n > g.size {
+		return g.size
+	}
+	return n
+}
@@ -0,0 +1,139 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package generate_test
+
+import (
+	"bytes"
+	"github.com/mdhender/lutymaps/pkg/adapters"
+	"github.com/mdhender/lutymaps/pkg/generate"
+	"github.com/mdhender/lutymaps/pkg/stores/mem"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// save generates a galaxy and returns the bytes of the saved galaxy file.
+func save(t *testing.T, path string, opts ...generate.Option) ([]mem.System, []byte) {
+	t.Helper()
+	systems, err := generate.New(opts...)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	mstore := mem.New()
+	if err = mstore.AddSystems(systems...); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	jstore, err := adapters.StoreToJSDB(mstore)
+	if err != nil {
+		t.Fatalf("adapt: %v", err)
+	}
+	if err = jstore.Save(path); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return systems, buf
+}
+
+// TestReproducible checks that every shape saves the same bytes for the same seed
+// and that the systems keep to the count, the bounds and the separation.
+func TestReproducible(t *testing.T) {
+	const count, size, separation = 300, 40, 1.5
+	for _, shape := range []generate.Shape{generate.ShapeCube, generate.ShapeSphere, generate.ShapeDisk, generate.ShapeSpiral, generate.ShapeClustered} {
+		t.Run(string(shape), func(t *testing.T) {
+			opts := []generate.Option{
+				generate.WithSeed(42),
+				generate.WithShape(shape),
+				generate.WithCount(count),
+				generate.WithSize(size),
+				generate.WithMinSeparation(separation),
+			}
+			dir := t.TempDir()
+			systems, first := save(t, filepath.Join(dir, "first.json"), opts...)
+			_, second := save(t, filepath.Join(dir, "second.json"), opts...)
+			if !bytes.Equal(first, second) {
+				t.Errorf("same seed: saved files differ")
+			}
+			_, other := save(t, filepath.Join(dir, "other.json"), append(opts, generate.WithSeed(43))...)
+			if bytes.Equal(first, other) {
+				t.Errorf("different seed: saved files are the same")
+			}
+
+			if len(systems) != count {
+				t.Fatalf("count: want %d: got %d", count, len(systems))
+			}
+			for i, a := range systems {
+				if a.Id != i+1 {
+					t.Errorf("system %d: want id %d: got %d", i, i+1, a.Id)
+				}
+				for _, c := range []int{a.X, a.Y, a.Z} {
+					if c < -size || c > size {
+						t.Fatalf("system %d: (%d, %d, %d) is outside -%d..%d", a.Id, a.X, a.Y, a.Z, size, size)
+					}
+				}
+				for _, b := range systems[i+1:] {
+					dx, dy, dz := float64(a.X-b.X), float64(a.Y-b.Y), float64(a.Z-b.Z)
+					if d := math.Sqrt(dx*dx + dy*dy + dz*dz); d < separation {
+						t.Fatalf("systems %d and %d: %g apart: want at least %g", a.Id, b.Id, d, separation)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestWeights(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		weights map[mem.SystemKind]int
+		ok      bool
+	}{
+		{"one kind", map[mem.SystemKind]int{mem.SKLightDustCloud: 1}, true},
+		{"all zero", map[mem.SystemKind]int{mem.SKLightDustCloud: 0}, false},
+		{"empty", map[mem.SystemKind]int{}, false},
+		{"negative", map[mem.SystemKind]int{mem.SKLightDustCloud: -1, mem.SKEmpty: 2}, false},
+		{"overflow", map[mem.SystemKind]int{mem.SKEmpty: math.MaxInt, mem.SKLightDustCloud: 1}, false},
+		{"too large", map[mem.SystemKind]int{mem.SKEmpty: math.MaxInt32, mem.SKLightDustCloud: 1}, false},
+	} {
+		systems, err := generate.New(generate.WithCount(50), generate.WithWeights(tc.weights))
+		if !tc.ok {
+			if err == nil {
+				t.Errorf("%s: want error: got nil", tc.name)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		for _, system := range systems {
+			if system.Kind != mem.SKLightDustCloud {
+				t.Fatalf("%s: system %d: want kind %v: got %v", tc.name, system.Id, mem.SKLightDustCloud, system.Kind)
+			}
+		}
+	}
+}
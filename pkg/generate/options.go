@@ -0,0 +1,181 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package generate
+
+import (
+	"fmt"
+	"github.com/mdhender/lutymaps/pkg/stores/mem"
+	"math"
+)
+
+// Option configures a galaxy generator.
+type Option func(*options) error
+
+// options holds the settings used to generate a galaxy.
+type options struct {
+	seed     int64                  // seed for the random number generator
+	size     int                    // systems are placed within -size..size on each axis
+	count    int                    // number of systems
+	shape    Shape                  // how systems are distributed
+	arms     int                    // number of arms in a spiral
+	clusters int                    // number of clusters
+	spacing  float64                // minimum distance between systems
+	weights  map[mem.SystemKind]int // relative frequency of each kind
+}
+
+// defaultOptions returns the settings for 10,000 systems in a 51x51x51 cube,
+// with kinds weighted like the original galaxy files.
+func defaultOptions() *options {
+	return &options{
+		seed:     1,
+		size:     25,
+		count:    10_000,
+		shape:    ShapeCube,
+		arms:     2,
+		clusters: 8,
+		spacing:  1,
+		weights: map[mem.SystemKind]int{
+			mem.SKBlueSuperGiant:     3,
+			mem.SKYellowMainSequence: 2,
+			mem.SKDenseDustCloud:     1,
+			mem.SKMediumDustCloud:    1,
+			mem.SKLightDustCloud:     1,
+		},
+	}
+}
+
+// WithSeed sets the seed for the random number generator.
+// The same seed and options always generate the same galaxy.
+func WithSeed(seed int64) Option {
+	return func(o *options) error {
+		o.seed = seed
+		return nil
+	}
+}
+
+// WithSize sets the extent of the galaxy.
+// Systems are placed within -size..size on each axis.
+func WithSize(size int) Option {
+	return func(o *options) error {
+		if size < 1 {
+			return fmt.Errorf("size must be positive: %d", size)
+		}
+		o.size = size
+		return nil
+	}
+}
+
+// WithCount sets the number of systems.
+func WithCount(count int) Option {
+	return func(o *options) error {
+		if count < 0 {
+			return fmt.Errorf("count must not be negative: %d", count)
+		}
+		o.count = count
+		return nil
+	}
+}
+
+// WithShape sets how systems are distributed.
+func WithShape(shape Shape) Option {
+	return func(o *options) error {
+		switch shape {
+		case ShapeCube, ShapeSphere, ShapeDisk, ShapeSpiral, ShapeClustered:
+		default:
+			return fmt.Errorf("unknown shape %q", shape)
+		}
+		o.shape = shape
+		return nil
+	}
+}
+
+// WithArms sets the number of arms in a spiral galaxy.
+func WithArms(arms int) Option {
+	return func(o *options) error {
+		if arms < 1 {
+			return fmt.Errorf("arms must be positive: %d", arms)
+		}
+		o.arms = arms
+		return nil
+	}
+}
+
+// WithClusters sets the number of clusters in a clustered galaxy.
+func WithClusters(clusters int) Option {
+	return func(o *options) error {
+		if clusters < 1 {
+			return fmt.Errorf("clusters must be positive: %d", clusters)
+		}
+		o.clusters = clusters
+		return nil
+	}
+}
+
+// WithMinSeparation sets the minimum distance between systems.
+// Systems never share coordinates, so distances of 1 or less have the same effect.
+func WithMinSeparation(distance float64) Option {
+	return func(o *options) error {
+		if distance < 0 {
+			return fmt.Errorf("min separation must not be negative: %g", distance)
+		}
+		o.spacing = math.Max(distance, 1)
+		return nil
+	}
+}
+
+// WithWeights sets the relative frequency of each kind.
+// Kinds that are not in the map are never generated. The weights must total at most math.MaxInt32.
+func WithWeights(weights map[mem.SystemKind]int) Option {
+	return func(o *options) error {
+		if err := validateWeights(weights); err != nil {
+			return err
+		}
+		o.weights = make(map[mem.SystemKind]int)
+		for kind, weight := range weights {
+			o.weights[kind] = weight
+		}
+		return nil
+	}
+}
+
+// validateWeights returns an error unless the weights are not negative
+// and total more than zero and at most math.MaxInt32.
+func validateWeights(weights map[mem.SystemKind]int) error {
+	total := 0
+	for kind, weight := range weights {
+		if weight < 0 {
+			return fmt.Errorf("kind %q: weight must not be negative: %d", kind, weight)
+		}
+		// check before adding so that large weights can't overflow the total
+		if weight > math.MaxInt32-total {
+			return fmt.Errorf("weights must not total more than %d", math.MaxInt32)
+		}
+		total += weight
+	}
+	if total == 0 {
+		return fmt.Errorf("weights must not all be zero")
+	}
+	return nil
+}
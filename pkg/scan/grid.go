@@ -0,0 +1,224 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package scan
+
+import (
+	gl "github.com/fogleman/fauxgl"
+	"github.com/golang/freetype"
+	"github.com/golang/freetype/truetype"
+	"github.com/mdhender/lutymaps/pkg/stores/mem"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"image"
+	"image/draw"
+	"math"
+	"strconv"
+	"sync"
+)
+
+// Plane is a grid plane, named for the axes that it contains.
+type Plane string
+
+const (
+	PlaneXY Plane = "xy"
+	PlaneXZ Plane = "xz"
+	PlaneYZ Plane = "yz"
+)
+
+// axisColors are the colors of the x, y and z axes and their tick labels.
+var axisColors = [3]gl.Color{gl.HexColor("#E05050"), gl.HexColor("#50C050"), gl.HexColor("#5080FF")}
+
+// marker is text drawn next to a point in the scene.
+type marker struct {
+	position gl.Vector
+	text     string
+	color    gl.Color
+}
+
+// bounds returns the corners of the box that holds the systems, snapped outward to the grid spacing.
+// The box is never empty; with no systems, it is one grid cell around the origin.
+// The origin isn't added to the box, so a sector far from the origin gets a grid of its own size.
+func bounds(systems mem.Systems, o *options) (lo, hi [3]float64) {
+	spacing := float64(o.gridSpacing)
+	if spacing == 0 {
+		spacing = 10
+	}
+	lo = [3]float64{o.origin.X, o.origin.Y, o.origin.Z}
+	hi = lo
+	first := true
+	for _, sys := range systems {
+		if sys == nil {
+			break
+		}
+		x, y, z := sys.Points()
+		for a, v := range [3]float64{x, y, z} {
+			if first || v < lo[a] {
+				lo[a] = v
+			}
+			if first || v > hi[a] {
+				hi[a] = v
+			}
+		}
+		first = false
+	}
+	for a := range lo {
+		lo[a] = spacing * math.Floor(lo[a]/spacing)
+		hi[a] = spacing * math.Ceil(hi[a]/spacing)
+		if hi[a] == lo[a] {
+			lo[a], hi[a] = lo[a]-spacing, hi[a]+spacing
+		}
+	}
+	return lo, hi
+}
+
+// clampOrigin returns the point in the box from lo to hi that is closest to the origin.
+// The grid planes and the axes pass through it, so they stay with the systems
+// when the origin is outside the box.
+func clampOrigin(o *options, lo, hi [3]float64) [3]float64 {
+	origin := [3]float64{o.origin.X, o.origin.Y, o.origin.Z}
+	for a := range origin {
+		origin[a] = math.Max(lo[a], math.Min(origin[a], hi[a]))
+	}
+	return origin
+}
+
+// gridLines returns lines every grid spacing, in galaxy coordinates, across each grid plane.
+// The planes pass through the origin, or the nearest point in the box if the origin is outside it,
+// and cover the box from lo to hi.
+func gridLines(o *options, lo, hi [3]float64) []*gl.Line {
+	if o.gridSpacing == 0 {
+		return nil
+	}
+	spacing := float64(o.gridSpacing)
+	origin := clampOrigin(o, lo, hi)
+	point := func(v [3]float64) gl.Vector { return gl.V(v[0], v[1], v[2]) }
+	var lines []*gl.Line
+	for _, plane := range o.gridPlanes {
+		// a and b are the axes in the plane; c is the axis that the plane is perpendicular to
+		var a, b, c int
+		switch plane {
+		case PlaneXY:
+			a, b, c = 0, 1, 2
+		case PlaneXZ:
+			a, b, c = 0, 2, 1
+		case PlaneYZ:
+			a, b, c = 1, 2, 0
+		}
+		for _, axes := range [2][2]int{{a, b}, {b, a}} {
+			along, across := axes[0], axes[1]
+			for v := lo[across]; v <= hi[across]; v += spacing {
+				var p1, p2 [3]float64
+				p1[c], p2[c] = origin[c], origin[c]
+				p1[across], p2[across] = v, v
+				p1[along], p2[along] = lo[along], hi[along]
+				lines = append(lines, gl.NewLineForPoints(point(p1), point(p2)))
+			}
+		}
+	}
+	return lines
+}
+
+// axisLines returns a line for each axis across the box from lo to hi,
+// and markers with the coordinates every grid spacing along the axes.
+// The axes pass through the origin, or the nearest point in the box if the origin is outside it.
+func axisLines(o *options, lo, hi [3]float64) (lines [3]*gl.Line, ticks []marker) {
+	origin := clampOrigin(o, lo, hi)
+	for a := range lines {
+		p1, p2 := origin, origin
+		p1[a], p2[a] = lo[a], hi[a]
+		lines[a] = gl.NewLineForPoints(gl.V(p1[0], p1[1], p1[2]), gl.V(p2[0], p2[1], p2[2]))
+		ticks = append(ticks, marker{position: gl.V(p2[0], p2[1], p2[2]), text: string("xyz"[a]), color: axisColors[a]})
+		if o.gridSpacing == 0 {
+			continue
+		}
+		spacing := float64(o.gridSpacing)
+		for v := spacing * math.Ceil(p1[a]/spacing); v < p2[a]; v += spacing {
+			p := origin
+			p[a] = v
+			ticks = append(ticks, marker{position: gl.V(p[0], p[1], p[2]), text: strconv.Itoa(int(v)), color: axisColors[a]})
+		}
+	}
+	return lines, ticks
+}
+
+// systemMarkers returns a marker for each system with its label.
+func systemMarkers(systems mem.Systems, o *options) []marker {
+	var markers []marker
+	for _, sys := range systems {
+		if sys == nil {
+			break
+		}
+		x, y, z := sys.Points()
+		markers = append(markers, marker{position: gl.V(x, y, z), text: systemLabel(sys, o), color: o.styles.Lookup(sys.Kind).color()})
+	}
+	return markers
+}
+
+// labelFont is the font for labels, parsed on first use.
+var labelFont struct {
+	sync.Once
+	font *truetype.Font
+	err  error
+}
+
+// drawMarkers draws the text of each marker that is in view next to the marker's position.
+// The labels are drawn over the scene, so they are not hidden by systems in front of them.
+func drawMarkers(dst draw.Image, markers []marker, matrix gl.Matrix, o *options) error {
+	if len(markers) == 0 {
+		return nil
+	}
+	labelFont.Do(func() {
+		labelFont.font, labelFont.err = freetype.ParseFont(goregular.TTF)
+	})
+	if labelFont.err != nil {
+		return labelFont.err
+	}
+	size := o.fontSize
+	if size == 0 {
+		size = math.Max(10, float64(o.height)/100)
+	}
+
+	fc := freetype.NewContext()
+	fc.SetDPI(72)
+	fc.SetFont(labelFont.font)
+	fc.SetFontSize(size)
+	fc.SetClip(dst.Bounds())
+	fc.SetDst(dst)
+	fc.SetHinting(font.HintingFull)
+	w, h := float64(o.width), float64(o.height)
+	for _, m := range markers {
+		p := matrix.MulPositionW(m.position)
+		if p.Outside() {
+			continue
+		}
+		// the text starts just right of and above the point
+		x, y := (p.X/p.W+1)*w/2+size/4, (1-p.Y/p.W)*h/2-size/4
+		fc.SetSrc(image.NewUniform(m.color.NRGBA()))
+		if _, err := fc.DrawString(m.text, freetype.Pt(int(x), int(y))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package scan
+
+import (
+	"fmt"
+	gl "github.com/fogleman/fauxgl"
+	"github.com/mdhender/lutymaps/pkg/stores/mem"
+	"testing"
+)
+
+func TestWithGrid(t *testing.T) {
+	for _, tc := range []struct {
+		spacing int
+		planes  []Plane
+		want    []Plane
+		wantErr bool
+	}{
+		{spacing: 10, want: []Plane{PlaneXY}},
+		{spacing: 0, planes: []Plane{PlaneYZ}, want: []Plane{PlaneYZ}},
+		{spacing: 5, planes: []Plane{PlaneXY, PlaneXZ, PlaneYZ}, want: []Plane{PlaneXY, PlaneXZ, PlaneYZ}},
+		{spacing: -1, wantErr: true},
+		{spacing: 10, planes: []Plane{PlaneXY, "xx"}, wantErr: true},
+		{spacing: 10, planes: []Plane{"XY"}, wantErr: true},
+	} {
+		o, err := newOptions([]Option{WithGrid(tc.spacing, tc.planes...)})
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("%d %v: want error: got nil", tc.spacing, tc.planes)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%d %v: %v", tc.spacing, tc.planes, err)
+			continue
+		}
+		if o.gridSpacing != tc.spacing || fmt.Sprint(o.gridPlanes) != fmt.Sprint(tc.want) {
+			t.Errorf("%d %v: want %d %v: got %d %v", tc.spacing, tc.planes, tc.spacing, tc.want, o.gridSpacing, o.gridPlanes)
+		}
+	}
+}
+
+// TestAxisTicks checks that ticks are at each multiple of the spacing along the axes, followed by the axis name.
+func TestAxisTicks(t *testing.T) {
+	systems := mem.Systems{{Id: 1, X: 3, Y: -12, Z: 0}, {Id: 2, X: 27, Y: 8, Z: 4}}
+	o, err := newOptions([]Option{WithGrid(10)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lo, hi := bounds(systems, o)
+	if lo != [3]float64{0, -20, 0} || hi != [3]float64{30, 10, 10} {
+		t.Fatalf("bounds: want [0 -20 0] [30 10 10]: got %v %v", lo, hi)
+	}
+	_, ticks := axisLines(o, lo, hi)
+	var got []string
+	for _, tick := range ticks {
+		got = append(got, fmt.Sprintf("%s@%g,%g,%g", tick.text, tick.position.X, tick.position.Y, tick.position.Z))
+	}
+	want := []string{
+		"x@30,0,0", "0@0,0,0", "10@10,0,0", "20@20,0,0",
+		"y@0,10,0", "-20@0,-20,0", "-10@0,-10,0", "0@0,0,0",
+		"z@0,0,10", "0@0,0,0",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("ticks:\n\twant %v\n\tgot  %v", want, got)
+	}
+}
+
+// TestGridAwayFromOrigin checks that the grid and the axes stay in the box around systems far from the origin.
+func TestGridAwayFromOrigin(t *testing.T) {
+	systems := mem.Systems{{Id: 1, X: 1000, Y: 2000, Z: -3000}, {Id: 2, X: 1015, Y: 2015, Z: -2985}}
+	o, err := newOptions([]Option{WithGrid(10, PlaneXY, PlaneXZ, PlaneYZ)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lo, hi := bounds(systems, o)
+	inside := func(v gl.Vector) bool {
+		for a, c := range [3]float64{v.X, v.Y, v.Z} {
+			if c < lo[a] || c > hi[a] {
+				return false
+			}
+		}
+		return true
+	}
+	grid := gridLines(o, lo, hi)
+	if len(grid) == 0 {
+		t.Fatalf("grid: no lines")
+	}
+	for _, line := range grid {
+		if !inside(line.V1.Position) || !inside(line.V2.Position) {
+			t.Fatalf("grid: line %v to %v is outside %v..%v", line.V1.Position, line.V2.Position, lo, hi)
+		}
+	}
+	axes, ticks := axisLines(o, lo, hi)
+	for a, line := range axes {
+		if !inside(line.V1.Position) || !inside(line.V2.Position) {
+			t.Errorf("axis %d: line %v to %v is outside %v..%v", a, line.V1.Position, line.V2.Position, lo, hi)
+		}
+	}
+	for _, tick := range ticks {
+		if !inside(tick.position) {
+			t.Errorf("tick %q: %v is outside %v..%v", tick.text, tick.position, lo, hi)
+		}
+	}
+
+	// an origin inside the box is kept
+	o.origin = gl.V(1010, 2000, -2990)
+	if got := clampOrigin(o, lo, hi); got != [3]float64{1010, 2000, -2990} {
+		t.Errorf("origin: want [1010 2000 -2990]: got %v", got)
+	}
+}
@@ -0,0 +1,309 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	gl "github.com/fogleman/fauxgl"
+	"github.com/fogleman/gg"
+	"github.com/fogleman/ln/ln"
+	"github.com/mdhender/lutymaps/pkg/stores/mem"
+	"html"
+	"image"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// lineStep is the distance, in galaxy units, between the points that are
+// checked for visibility when drawing lines. Smaller steps give cleaner
+// edges where lines pass behind systems but take longer to render.
+const lineStep = 0.05
+
+// drawing is a scan rendered as lines.
+// Coordinates are in pixels with the origin at the bottom left.
+type drawing struct {
+	width, height float64
+	background    gl.Color
+	layers        []layer
+	labels        []label
+}
+
+// layer is a set of paths drawn in the same color.
+type layer struct {
+	color gl.Color
+	paths ln.Paths
+}
+
+// label is text drawn at a point.
+type label struct {
+	x, y  float64
+	text  string
+	color gl.Color
+	align float64 // 0 puts the start of the text at the point, 0.5 the middle and 1 the end
+}
+
+// NewSVG renders the systems as lines and saves the drawing as an SVG file to the path.
+// The drawing is rendered before the file is created, so a failed render leaves any old file alone.
+func NewSVG(systems mem.Systems, path string, opts ...Option) error {
+	buf := &bytes.Buffer{}
+	if err := RenderSVG(buf, systems, opts...); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("scan: %w", err)
+	}
+
+	fmt.Printf("scan: created %q\n", path)
+	return nil
+}
+
+// RenderSVG renders the systems as lines and writes the drawing as SVG.
+// Systems are drawn as outline spheres, in the color of their style,
+// over a grid in the xy plane through the origin.
+func RenderSVG(w io.Writer, systems mem.Systems, opts ...Option) error {
+	o, err := newOptions(opts)
+	if err != nil {
+		return err
+	}
+	if err = drawLines(systems, o).writeSVG(w); err != nil {
+		return fmt.Errorf("scan: %w", err)
+	}
+	return nil
+}
+
+// NewLines renders the systems as lines and saves the drawing as a PNG to the path.
+func NewLines(systems mem.Systems, path string, opts ...Option) error {
+	img, err := RenderLines(systems, opts...)
+	if err != nil {
+		return err
+	}
+	err = gl.SavePNG(path, img)
+	if err != nil {
+		return fmt.Errorf("scan: %w", err)
+	}
+
+	fmt.Printf("scan: created %q\n", path)
+	return nil
+}
+
+// RenderLines renders the systems as lines, like RenderSVG, and returns the image.
+func RenderLines(systems mem.Systems, opts ...Option) (image.Image, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	return drawLines(systems, o).image(), nil
+}
+
+// drawLines projects the systems, the grid and the labels into a drawing.
+func drawLines(systems mem.Systems, o *options) *drawing {
+	start := time.Now()
+	defer func(s time.Time) {
+		fmt.Printf("scan: lines: %v\n", time.Since(s))
+	}(start)
+
+	d := &drawing{width: float64(o.width), height: float64(o.height), background: o.background}
+	eye, center, up := lnVector(o.eye), lnVector(o.center), lnVector(o.up)
+	matrix := ln.LookAt(eye, center, up).Perspective(o.fovy, d.width/d.height, o.near, o.far)
+	screen := ln.Translate(ln.Vector{X: 1, Y: 1}).Scale(ln.Vector{X: d.width / 2, Y: d.height / 2})
+
+	// project returns the screen position of the point if it is inside the view
+	project := func(v ln.Vector) (x, y float64, ok bool) {
+		w := matrix.MulPositionW(v)
+		if !ln.ClipBox.Contains(w) {
+			return 0, 0, false
+		}
+		w = screen.MulPosition(w)
+		return w.X, w.Y, true
+	}
+
+	// every system is part of the scene so that it can hide lines behind it
+	scene := &ln.Scene{}
+	type frontLabel struct {
+		front ln.Vector
+		label
+	}
+	var labels []frontLabel
+	spheres := make(map[mem.SystemKind]ln.Paths)
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, sys := range systems {
+		if sys == nil {
+			continue
+		}
+		x, y, z := sys.Points()
+		position := ln.Vector{X: x, Y: y, Z: z}
+		sphere := ln.NewOutlineSphere(eye, up, position, o.styles.Lookup(sys.Kind).Size)
+		scene.Add(sphere)
+		spheres[sys.Kind] = append(spheres[sys.Kind], sphere.Paths()...)
+		minX, minY, maxX, maxY = math.Min(minX, x), math.Min(minY, y), math.Max(maxX, x), math.Max(maxY, y)
+
+		if text := systemLabel(sys, o); text != "" {
+			if sx, sy, ok := project(position); ok {
+				// the front of the sphere is used to check that the system isn't hidden
+				front := position.Add(eye.Sub(position).Normalize().MulScalar(sphere.Radius * 1.01))
+				labels = append(labels, frontLabel{front: front, label: label{x: sx + 4, y: sy, text: text, color: o.styles.Lookup(sys.Kind).color()}})
+			}
+		}
+	}
+	scene.Compile()
+	for _, l := range labels {
+		if scene.Visible(eye, l.front) {
+			d.labels = append(d.labels, l.label)
+		}
+	}
+
+	clip := &ln.ClipFilter{Matrix: matrix, Eye: eye, Scene: scene}
+	addLayer := func(color gl.Color, paths ln.Paths) {
+		// simplify after moving to the screen so that detail smaller than a pixel is dropped
+		paths = paths.Chop(lineStep).Filter(clip).Transform(screen).Simplify(0.25)
+		if len(paths) != 0 {
+			d.layers = append(d.layers, layer{color: color, paths: paths})
+		}
+	}
+
+	// grid lines cover the systems, snapped to the grid spacing
+	if len(scene.Shapes) != 0 && o.gridSpacing != 0 {
+		gridSpacing := float64(o.gridSpacing)
+		x0, x1 := gridSpacing*math.Floor(minX/gridSpacing), gridSpacing*math.Ceil(maxX/gridSpacing)
+		y0, y1 := gridSpacing*math.Floor(minY/gridSpacing), gridSpacing*math.Ceil(maxY/gridSpacing)
+		// the grid is in the plane through the origin unless that is outside the systems' box
+		lo, hi := bounds(systems, o)
+		z := math.Max(lo[2], math.Min(o.origin.Z, hi[2]))
+		var grid ln.Paths
+		for x := x0; x <= x1; x += gridSpacing {
+			grid = append(grid, ln.Path{{X: x, Y: y0, Z: z}, {X: x, Y: y1, Z: z}})
+			if sx, sy, ok := project(ln.Vector{X: x, Y: y0, Z: z}); ok {
+				d.labels = append(d.labels, label{x: sx, y: sy, text: strconv.Itoa(int(x)), color: o.color})
+			}
+		}
+		for y := y0; y <= y1; y += gridSpacing {
+			grid = append(grid, ln.Path{{X: x0, Y: y, Z: z}, {X: x1, Y: y, Z: z}})
+			if sx, sy, ok := project(ln.Vector{X: x0, Y: y, Z: z}); ok {
+				d.labels = append(d.labels, label{x: sx, y: sy, text: strconv.Itoa(int(y)), color: o.color})
+			}
+		}
+		addLayer(o.color, grid)
+	}
+
+	// draw the systems in kind order so the output is repeatable
+	var kinds []mem.SystemKind
+	for kind := range spheres {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool { return kinds[i] < kinds[j] })
+	for _, kind := range kinds {
+		addLayer(o.styles.Lookup(kind).color(), spheres[kind])
+	}
+
+	return d
+}
+
+// writeSVG writes the drawing as an SVG document.
+func (d *drawing) writeSVG(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "<svg xmlns=\"http://www.w3.org/2000/svg\" version=\"1.1\" width=\"%g\" height=\"%g\" viewBox=\"0 0 %g %g\">\n", d.width, d.height, d.width, d.height)
+	d.writeSVGElements(bw)
+	bw.WriteString("</svg>\n")
+	return bw.Flush()
+}
+
+// writeSVGElements writes the contents of the drawing's SVG element.
+func (d *drawing) writeSVGElements(bw *bufio.Writer) {
+	fmt.Fprintf(bw, "<rect width=\"100%%\" height=\"100%%\" fill=\"%s\"/>\n", hexColor(d.background))
+	// flip the y axis so that the origin is at the bottom left, like the drawing
+	fmt.Fprintf(bw, "<g transform=\"translate(0,%g) scale(1,-1)\" fill=\"none\" stroke-width=\"1\">\n", d.height)
+	for _, l := range d.layers {
+		fmt.Fprintf(bw, "<g stroke=\"%s\">\n", hexColor(l.color))
+		for _, path := range l.paths {
+			if len(path) < 2 {
+				continue
+			}
+			bw.WriteString("<polyline points=\"")
+			for i, v := range path {
+				if i != 0 {
+					bw.WriteByte(' ')
+				}
+				fmt.Fprintf(bw, "%.1f,%.1f", v.X, v.Y)
+			}
+			bw.WriteString("\"/>\n")
+		}
+		bw.WriteString("</g>\n")
+	}
+	bw.WriteString("</g>\n")
+	if len(d.labels) != 0 {
+		bw.WriteString("<g font-family=\"sans-serif\" font-size=\"10\">\n")
+		for _, l := range d.labels {
+			anchor := ""
+			if l.align == 0.5 {
+				anchor = " text-anchor=\"middle\""
+			} else if l.align == 1 {
+				anchor = " text-anchor=\"end\""
+			}
+			fmt.Fprintf(bw, "<text x=\"%.1f\" y=\"%.1f\" fill=\"%s\"%s>%s</text>\n", l.x, d.height-l.y, hexColor(l.color), anchor, html.EscapeString(l.text))
+		}
+		bw.WriteString("</g>\n")
+	}
+}
+
+// image rasterizes the drawing.
+func (d *drawing) image() image.Image {
+	dc := gg.NewContext(int(d.width), int(d.height))
+	dc.SetRGBA(d.background.R, d.background.G, d.background.B, d.background.A)
+	dc.Clear()
+	dc.SetLineWidth(1)
+	for _, l := range d.layers {
+		dc.SetRGBA(l.color.R, l.color.G, l.color.B, l.color.A)
+		for _, path := range l.paths {
+			for _, v := range path {
+				dc.LineTo(v.X, d.height-v.Y)
+			}
+			dc.NewSubPath()
+		}
+		dc.Stroke()
+	}
+	for _, l := range d.labels {
+		dc.SetRGBA(l.color.R, l.color.G, l.color.B, l.color.A)
+		dc.DrawStringAnchored(l.text, l.x, d.height-l.y, l.align, 0)
+	}
+	return dc.Image()
+}
+
+// hexColor returns the color as "#rrggbb".
+func hexColor(c gl.Color) string {
+	channel := func(f float64) int {
+		return int(math.Round(math.Max(0, math.Min(1, f)) * 255))
+	}
+	return fmt.Sprintf("#%02x%02x%02x", channel(c.R), channel(c.G), channel(c.B))
+}
+
+func lnVector(v gl.Vector) ln.Vector {
+	return ln.Vector{X: v.X, Y: v.Y, Z: v.Z}
+}
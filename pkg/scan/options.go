@@ -0,0 +1,400 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package scan
+
+import (
+	"fmt"
+	gl "github.com/fogleman/fauxgl"
+	"runtime"
+	"time"
+)
+
+// Option configures a sector scan.
+type Option func(*options) error
+
+// options holds the settings used to render a scan.
+type options struct {
+	width, height int       // output size in pixels
+	scale         int       // supersampling factor
+	fovy          float64   // vertical field of view in degrees
+	near, far     float64   // clipping planes
+	eye           gl.Vector // camera position
+	center        gl.Vector // view center position
+	up            gl.Vector // up vector
+	light         gl.Vector // light direction
+	color         gl.Color  // grid color
+	gridSpacing   int       // distance between grid lines; 0 hides the grid
+	gridPlanes    []Plane   // grid planes, through the origin
+	origin        gl.Vector // point that the axes and the grid planes pass through
+	axes          bool      // draw the axes and their tick labels
+	background    gl.Color  // background color
+	styles        Styles    // system styles by kind
+	labels        bool      // label systems with their name or id
+	coordinates   bool      // label systems with their coordinates instead
+	planetCounts  bool      // label systems with the number of planets they have
+	fontSize      float64   // label size in pixels; 0 scales with the image
+	workers       int       // number of goroutines building meshes and rendering tiles
+	tileSize      int       // tile width and height in output pixels; 0 renders one tile
+	memoryLimit   int64     // bytes of tile buffers allowed at the same time
+	// slices
+	sliceAxis          Axis   // axis to slice along
+	sliceThickness     int    // number of coordinates in each layer
+	sliceBounded       bool   // use sliceMin and sliceMax as the frame
+	sliceMin, sliceMax [3]int // corners of the frame
+	sliceLevels        bool   // only slice from sliceFrom to sliceTo
+	sliceFrom, sliceTo int    // coordinates of the first and last layers
+	// turntables
+	frames       int           // number of frames
+	elevation    float64       // camera elevation in degrees
+	elevationSet bool          // use elevation instead of the elevation of the eye
+	frameDelay   time.Duration // time between frames
+}
+
+// defaultOptions returns the settings for a 3200x3200 view from (50,50,0).
+func defaultOptions() *options {
+	return &options{
+		width:          3200,
+		height:         3200,
+		scale:          4,
+		fovy:           60,
+		near:           1,
+		far:            100,
+		eye:            gl.V(50, 50, 0),
+		center:         gl.V(0, 0, 0),
+		up:             gl.V(0, 0, 1),
+		light:          gl.V(0.75, 0.5, 1).Normalize(),
+		color:          gl.HexColor("#468966"),
+		gridSpacing:    10,
+		gridPlanes:     []Plane{PlaneXY},
+		axes:           true,
+		background:     gl.Black,
+		styles:         DefaultStyles(),
+		workers:        runtime.NumCPU(),
+		tileSize:       512,
+		memoryLimit:    1 << 30,
+		sliceAxis:      AxisZ,
+		sliceThickness: 1,
+		frames:         36,
+		frameDelay:     100 * time.Millisecond,
+	}
+}
+
+// newOptions returns the default settings with the options applied.
+func newOptions(opts []Option) (*options, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+	}
+	return o, nil
+}
+
+// WithImageSize sets the size of the output image in pixels.
+func WithImageSize(width, height int) Option {
+	return func(o *options) error {
+		if width < 1 || height < 1 {
+			return fmt.Errorf("image size must be positive: %dx%d", width, height)
+		}
+		o.width, o.height = width, height
+		return nil
+	}
+}
+
+// WithSupersampling sets the supersampling factor used for antialiasing.
+// A factor of 1 disables supersampling.
+func WithSupersampling(scale int) Option {
+	return func(o *options) error {
+		if scale < 1 {
+			return fmt.Errorf("supersampling factor must be positive: %d", scale)
+		}
+		o.scale = scale
+		return nil
+	}
+}
+
+// WithCamera sets the camera position, the point it looks at, and the up vector.
+func WithCamera(eye, center, up gl.Vector) Option {
+	return func(o *options) error {
+		if eye == center {
+			return fmt.Errorf("camera eye and center must differ")
+		}
+		if up.Length() == 0 {
+			return fmt.Errorf("camera up vector must not be zero")
+		}
+		o.eye, o.center, o.up = eye, center, up
+		return nil
+	}
+}
+
+// WithProjection sets the vertical field of view (in degrees) and the clipping planes.
+func WithProjection(fovy, near, far float64) Option {
+	return func(o *options) error {
+		if fovy <= 0 || fovy >= 180 {
+			return fmt.Errorf("field of view must be between 0 and 180: %g", fovy)
+		}
+		if near <= 0 || far <= near {
+			return fmt.Errorf("clipping planes must satisfy 0 < near < far: %g, %g", near, far)
+		}
+		o.fovy, o.near, o.far = fovy, near, far
+		return nil
+	}
+}
+
+// WithLight sets the direction of the light.
+func WithLight(direction gl.Vector) Option {
+	return func(o *options) error {
+		if direction.Length() == 0 {
+			return fmt.Errorf("light direction must not be zero")
+		}
+		o.light = direction.Normalize()
+		return nil
+	}
+}
+
+// WithBackground sets the background color.
+func WithBackground(color gl.Color) Option {
+	return func(o *options) error {
+		o.background = color
+		return nil
+	}
+}
+
+// WithStyles sets the style table used to draw systems.
+func WithStyles(styles Styles) Option {
+	return func(o *options) error {
+		for kind, style := range styles {
+			if err := style.validate(); err != nil {
+				return fmt.Errorf("style %q: %w", kind, err)
+			}
+		}
+		o.styles = styles
+		return nil
+	}
+}
+
+// WithLabels sets whether systems are labeled with their name, or their id if they have no name.
+func WithLabels(labels bool) Option {
+	return func(o *options) error {
+		o.labels = labels
+		return nil
+	}
+}
+
+// WithCoordinateLabels sets whether labels show the coordinates of systems rather than their names.
+// Systems are labeled only if WithLabels is set.
+func WithCoordinateLabels(coordinates bool) Option {
+	return func(o *options) error {
+		o.coordinates = coordinates
+		return nil
+	}
+}
+
+// WithPlanetCounts sets whether systems are labeled with the number of planets they have.
+// The count follows the name or coordinates if WithLabels is set.
+func WithPlanetCounts(counts bool) Option {
+	return func(o *options) error {
+		o.planetCounts = counts
+		return nil
+	}
+}
+
+// WithFontSize sets the height of labels on shaded scans, in pixels.
+// Zero scales the labels with the height of the image.
+func WithFontSize(size float64) Option {
+	return func(o *options) error {
+		if size < 0 {
+			return fmt.Errorf("font size must not be negative: %g", size)
+		}
+		o.fontSize = size
+		return nil
+	}
+}
+
+// WithGrid sets the distance between grid lines and the planes they are drawn in.
+// The lines are at multiples of the spacing and cover the systems being scanned.
+// A spacing of zero hides the grid; with no planes, the grid is in the xy plane.
+// Drawings made with lines only have the xy plane.
+func WithGrid(spacing int, planes ...Plane) Option {
+	return func(o *options) error {
+		if spacing < 0 {
+			return fmt.Errorf("grid spacing must not be negative: %d", spacing)
+		}
+		for _, plane := range planes {
+			switch plane {
+			case PlaneXY, PlaneXZ, PlaneYZ:
+			default:
+				return fmt.Errorf("unknown grid plane %q", plane)
+			}
+		}
+		if len(planes) == 0 {
+			planes = []Plane{PlaneXY}
+		}
+		o.gridSpacing, o.gridPlanes = spacing, planes
+		return nil
+	}
+}
+
+// WithOrigin sets the point that the axes and the grid planes pass through.
+// If it is outside the box around the systems, they pass through the nearest point in the box instead.
+func WithOrigin(origin gl.Vector) Option {
+	return func(o *options) error {
+		o.origin = origin
+		return nil
+	}
+}
+
+// WithAxes sets whether shaded scans draw the x, y and z axes, in red, green and blue,
+// with their coordinates at each grid line.
+func WithAxes(axes bool) Option {
+	return func(o *options) error {
+		o.axes = axes
+		return nil
+	}
+}
+
+// WithWorkers sets the number of goroutines that build meshes and render tiles.
+// Zero uses one worker for each CPU.
+func WithWorkers(n int) Option {
+	return func(o *options) error {
+		if n < 0 {
+			return fmt.Errorf("workers must not be negative: %d", n)
+		}
+		if n == 0 {
+			n = runtime.NumCPU()
+		}
+		o.workers = n
+		return nil
+	}
+}
+
+// WithTileSize sets the width and height, in output pixels, of the tiles that an image is split into.
+// The size is reduced if a tile doesn't fit in the memory limit.
+// Zero renders the image as a single tile, whatever the memory limit.
+func WithTileSize(size int) Option {
+	return func(o *options) error {
+		if size < 0 {
+			return fmt.Errorf("tile size must not be negative: %d", size)
+		}
+		o.tileSize = size
+		return nil
+	}
+}
+
+// WithMemoryLimit caps the bytes used by the tiles being rendered at the same time.
+// Each tile needs about 16 bytes for every supersampled pixel, so the limit reduces
+// the number of tiles rendered at once and then the size of the tiles.
+// The output image and the meshes are not counted.
+func WithMemoryLimit(bytes int64) Option {
+	return func(o *options) error {
+		if bytes < 1 {
+			return fmt.Errorf("memory limit must be positive: %d", bytes)
+		}
+		o.memoryLimit = bytes
+		return nil
+	}
+}
+
+// WithSliceAxis sets the axis that slices are cut along.
+func WithSliceAxis(axis Axis) Option {
+	return func(o *options) error {
+		switch axis {
+		case AxisX, AxisY, AxisZ:
+		default:
+			return fmt.Errorf("unknown axis %q", axis)
+		}
+		o.sliceAxis = axis
+		return nil
+	}
+}
+
+// WithSliceThickness sets the number of coordinates in each slice.
+func WithSliceThickness(n int) Option {
+	return func(o *options) error {
+		if n < 1 {
+			return fmt.Errorf("slice thickness must be positive: %d", n)
+		}
+		o.sliceThickness = n
+		return nil
+	}
+}
+
+// WithSliceBounds sets the frame of the slices to the box with corners x1, y1, z1 and x2, y2, z2.
+// Systems outside the box are not drawn.
+func WithSliceBounds(x1, y1, z1, x2, y2, z2 int) Option {
+	return func(o *options) error {
+		o.sliceMin = [3]int{minInt(x1, x2), minInt(y1, y2), minInt(z1, z2)}
+		o.sliceMax = [3]int{maxInt(x1, x2), maxInt(y1, y2), maxInt(z1, z2)}
+		o.sliceBounded = true
+		return nil
+	}
+}
+
+// WithSliceLevels limits the slices to the layers from one coordinate to another along the slice axis.
+func WithSliceLevels(from, to int) Option {
+	return func(o *options) error {
+		if to < from {
+			return fmt.Errorf("slice levels must satisfy from <= to: %d, %d", from, to)
+		}
+		o.sliceFrom, o.sliceTo = from, to
+		o.sliceLevels = true
+		return nil
+	}
+}
+
+// WithFrames sets the number of frames in a turntable.
+func WithFrames(n int) Option {
+	return func(o *options) error {
+		if n < 1 {
+			return fmt.Errorf("frames must be positive: %d", n)
+		}
+		o.frames = n
+		return nil
+	}
+}
+
+// WithElevation sets the angle, in degrees, of the turntable camera above the plane it turns in.
+// Without it, the camera keeps the elevation of the eye.
+func WithElevation(degrees float64) Option {
+	return func(o *options) error {
+		if degrees <= -90 || degrees >= 90 {
+			return fmt.Errorf("elevation must be between -90 and 90: %g", degrees)
+		}
+		o.elevation, o.elevationSet = degrees, true
+		return nil
+	}
+}
+
+// WithFrameDelay sets the time between frames of an animation.
+// GIFs store delays in hundredths of a second, so shorter delays are rounded down.
+func WithFrameDelay(delay time.Duration) Option {
+	return func(o *options) error {
+		if delay < 0 {
+			return fmt.Errorf("frame delay must not be negative: %v", delay)
+		}
+		o.frameDelay = delay
+		return nil
+	}
+}
@@ -29,101 +29,158 @@ import (
 	"fmt"
 	gl "github.com/fogleman/fauxgl"
 	"github.com/mdhender/lutymaps/pkg/stores/mem"
-	"github.com/nfnt/resize"
+	"image"
+	"sort"
+	"strconv"
+	"sync"
 	"time"
 )
 
-const (
-	scale  = 4    // optional supersampling
-	width  = 3200 // output width in pixels
-	height = 3200 // output height in pixels
-	fovy   = 60   // vertical field of view in degrees
-	near   = 1    // near clipping plane
-	far    = 100  // far clipping plane
-)
+// New renders the systems and saves the image as a PNG to the path.
+func New(systems mem.Systems, path string, opts ...Option) error {
+	img, err := Render(systems, opts...)
+	if err != nil {
+		return err
+	}
+	err = gl.SavePNG(path, img)
+	if err != nil {
+		return fmt.Errorf("scan: %w", err)
+	}
 
-var (
-	eye        = gl.V(50, 50, 0)                // camera position
-	center     = gl.V(0, 0, 0)                  // view center position
-	up         = gl.V(0, 0, 1)                  // up vector
-	light      = gl.V(0.75, 0.5, 1).Normalize() // light direction
-	color      = gl.HexColor("#468966")         // object color
-	background = gl.HexColor("#FFF8E3")         // background color
-)
+	fmt.Printf("scan: created %q\n", path)
+	return nil
+}
+
+// Render renders the systems and returns the image.
+func Render(systems mem.Systems, opts ...Option) (image.Image, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
 
-func New(store *mem.Store, filter func(*mem.System) bool, path string) error {
 	start := time.Now()
 	defer func(s time.Time) {
 		fmt.Printf("scan: %v\n", time.Since(s))
 	}(start)
 
-	systems := store.Filter(filter)
-	fmt.Printf("scan: systems %d\n", len(systems))
+	sc, err := newScene(systems, o)
+	if err != nil {
+		return nil, err
+	}
+	return sc.render(o)
+}
 
-	// create a rendering context
-	context := gl.NewContext(width*scale, height*scale)
-	context.ClearColorBufferWith(gl.Black)
+// scene holds the meshes for a scan so that they can be drawn from more than one view.
+type scene struct {
+	grid    []*gl.Line                  // grid lines
+	axes    [3]*gl.Line                 // x, y and z axes; nil if they aren't drawn
+	markers []marker                    // tick and system labels
+	kinds   []mem.SystemKind            // kinds with systems, in order
+	meshes  map[mem.SystemKind]*gl.Mesh // systems by kind
+	count   int                         // number of systems
+}
 
-	// create transformation matrix and light direction
-	aspect := float64(width) / float64(height)
-	matrix := gl.LookAt(eye, center, up).Perspective(fovy, aspect, near, far)
+// newScene creates the grid, the axes, the labels and the meshes for the systems.
+func newScene(systems mem.Systems, o *options) (*scene, error) {
+	start := time.Now()
+	fmt.Printf("scan: systems %d\n", len(systems))
+	fmt.Printf("scan: planets %d\n", mem.PlanetCount(systems))
 
-	// create a mesh for the grid points
-	gridMesh := gl.NewEmptyMesh()
-	for x := -30; x <= 30; x = x + 10 {
-		for y := -30; y <= 30; y = y + 10 {
-			for z := -30; z <= 30; z = z + 10 {
-				p := gl.Vector{float64(x), float64(y), float64(z)}.MulScalar(4)
-				s := gl.V(0.2, 0.2, 0.2)
-				u := gl.Vector{1, 1, 1}.Normalize()
-				a := 0.0 // rand.Float64() * 2 * math.Pi
-				c := gl.NewCube()
-				c.Transform(gl.Orient(p, s, u, a))
-				gridMesh.Add(c)
+	// the grid and the axes are in galaxy coordinates and cover the systems
+	sc := &scene{}
+	lo, hi := bounds(systems, o)
+	sc.grid = gridLines(o, lo, hi)
+	if o.axes {
+		sc.axes, sc.markers = axisLines(o, lo, hi)
+	}
+	if o.labels || o.planetCounts {
+		sc.markers = append(sc.markers, systemMarkers(systems, o)...)
+	}
+
+	// create a mesh for the stars of each kind, splitting the systems between the workers
+	n := 0
+	for n < len(systems) && systems[n] != nil {
+		n++
+	}
+	chunks := minInt(o.workers, n)
+	chunkMeshes := make([]map[mem.SystemKind]*gl.Mesh, chunks)
+	errs := make([]error, chunks)
+	var wg sync.WaitGroup
+	for c := 0; c < chunks; c++ {
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+			chunkMeshes[c], errs[c] = systemMeshes(systems[c*n/chunks:(c+1)*n/chunks], o.styles)
+		}(c)
+	}
+	wg.Wait()
+	// merge the chunks in order so the output is repeatable
+	starMeshes := make(map[mem.SystemKind]*gl.Mesh)
+	for c := 0; c < chunks; c++ {
+		if errs[c] != nil {
+			return nil, fmt.Errorf("scan: %w", errs[c])
+		}
+		for kind, mesh := range chunkMeshes[c] {
+			if starMeshes[kind] == nil {
+				starMeshes[kind] = gl.NewEmptyMesh()
 			}
+			starMeshes[kind].Add(mesh)
 		}
 	}
-	// render the grid mesh
-	gridShader := gl.NewPhongShader(matrix, light, eye)
-	gridShader.ObjectColor = color
-	context.Shader = gridShader
-	context.DrawMesh(gridMesh)
-	fmt.Printf("scan: grid lines: %v\n", time.Since(start))
+	// render the star meshes in kind order so the output is repeatable
+	var kinds []mem.SystemKind
+	for kind := range starMeshes {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool { return kinds[i] < kinds[j] })
+	fmt.Printf("scan: meshes: %v\n", time.Since(start))
+
+	sc.kinds, sc.meshes, sc.count = kinds, starMeshes, n
+	return sc, nil
+}
 
-	// create a mesh for the stars
-	starMesh := gl.NewEmptyMesh()
+// systemMeshes creates a mesh for the systems of each kind.
+func systemMeshes(systems mem.Systems, styles Styles) (map[mem.SystemKind]*gl.Mesh, error) {
+	starMeshes := make(map[mem.SystemKind]*gl.Mesh)
 	for _, sys := range systems {
-		if sys == nil {
-			break
-		}
-		sp, err := gl.LoadSTL("sphere.stl")
+		style := styles.Lookup(sys.Kind)
+		sp, err := newMesh(style.Shape)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
-		sp.SmoothNormals()
-		sp.Transform(gl.Scale(gl.V(0.4, 0.4, 0.4)))
+		sp.Transform(gl.Scale(gl.V(style.Size, style.Size, style.Size)))
 		x, y, z := sys.Points()
 		sp.Transform(gl.Translate(gl.V(x, y, z)))
-		starMesh.Add(sp)
+		if starMeshes[sys.Kind] == nil {
+			starMeshes[sys.Kind] = gl.NewEmptyMesh()
+		}
+		starMeshes[sys.Kind].Add(sp)
 	}
-	// render the starmesh
-	starShader := gl.NewPhongShader(matrix, light, eye)
-	starShader.ObjectColor = gl.HexColor("9DFFFF").Alpha(0.75)
-	starShader.SpecularPower = 0
-	context.Shader = starShader
-	context.DrawMesh(starMesh)
-	context.Wireframe = true
-	context.DepthBias = -0.00001
-	context.DrawMesh(starMesh)
-	fmt.Printf("scan: stars: %5d: %v\n", len(systems), time.Since(start))
+	return starMeshes, nil
+}
 
-	// down-sample image for antialiasing
-	img := resize.Resize(width, height, context.Image(), resize.Bilinear)
-	err := gl.SavePNG(path, img)
-	if err != nil {
-		return fmt.Errorf("scan: %w", err)
+// systemLabel returns the text that labels the system: its name, id or coordinates,
+// followed by the number of planets it has if planet counts are shown.
+// It returns an empty string if systems aren't labeled.
+func systemLabel(sys *mem.System, o *options) string {
+	var text string
+	if o.labels {
+		if o.coordinates {
+			text = fmt.Sprintf("%d,%d,%d", sys.X, sys.Y, sys.Z)
+		} else if text = sys.Name; text == "" {
+			text = strconv.Itoa(sys.Id)
+		}
 	}
-
-	fmt.Printf("scan: created %q\n", path)
-	return nil
+	if o.planetCounts {
+		count := fmt.Sprintf("%d planets", len(sys.Planets))
+		if len(sys.Planets) == 1 {
+			count = "1 planet"
+		}
+		if text == "" {
+			text = count
+		} else {
+			text = fmt.Sprintf("%s (%s)", text, count)
+		}
+	}
+	return text
 }
@@ -0,0 +1,187 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package scan
+
+import (
+	"fmt"
+	"github.com/mdhender/lutymaps/pkg/stores/mem"
+	"image"
+	"math/rand"
+	"runtime"
+	"testing"
+)
+
+// testSystems returns n systems of every kind scattered through a cube around the origin.
+func testSystems(n int) mem.Systems {
+	kinds := []mem.SystemKind{mem.SKBlueSuperGiant, mem.SKDenseDustCloud, mem.SKMediumDustCloud, mem.SKYellowMainSequence, mem.SKLightDustCloud}
+	rnd := rand.New(rand.NewSource(1))
+	var systems mem.Systems
+	for i := 0; i < n; i++ {
+		systems = append(systems, &mem.System{
+			Id:   i + 1,
+			X:    rnd.Intn(61) - 30,
+			Y:    rnd.Intn(61) - 30,
+			Z:    rnd.Intn(21) - 10,
+			Kind: kinds[i%len(kinds)],
+		})
+	}
+	return systems
+}
+
+// TestTiledRender checks that a tiled scan matches the same scan rendered as a single tile.
+// Pixels along the tile seams may be rasterized a little differently,
+// so a few pixels are allowed to differ by a small amount.
+func TestTiledRender(t *testing.T) {
+	systems := testSystems(300)
+	opts := []Option{WithImageSize(400, 300), WithSupersampling(2), WithLabels(true)}
+
+	want, err := Render(systems, append(opts, WithTileSize(0))...)
+	if err != nil {
+		t.Fatalf("untiled: %v", err)
+	}
+	for _, workers := range []int{1, 3} {
+		got, err := Render(systems, append(opts, WithTileSize(64), WithWorkers(workers))...)
+		if err != nil {
+			t.Fatalf("tiled: workers %d: %v", workers, err)
+		}
+		if got.Bounds() != want.Bounds() {
+			t.Fatalf("tiled: workers %d: want bounds %v: got %v", workers, want.Bounds(), got.Bounds())
+		}
+		differ, worst := compareImages(want, got)
+		t.Logf("workers %d: %d pixels differ, by up to %d", workers, differ, worst)
+		if total := want.Bounds().Dx() * want.Bounds().Dy(); differ > total/1000 || worst > 96 {
+			t.Errorf("tiled: workers %d: %d of %d pixels differ, by up to %d", workers, differ, total, worst)
+		}
+	}
+}
+
+// compareImages returns the number of pixels that differ and the largest difference in any channel.
+func compareImages(a, b image.Image) (differ int, worst uint32) {
+	r := a.Bounds()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			r1, g1, b1, _ := a.At(x, y).RGBA()
+			r2, g2, b2, _ := b.At(x, y).RGBA()
+			d := maxUint32(absDiff(r1, r2), maxUint32(absDiff(g1, g2), absDiff(b1, b2))) >> 8
+			if d != 0 {
+				differ++
+			}
+			worst = maxUint32(worst, d)
+		}
+	}
+	return differ, worst
+}
+
+func absDiff(a, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+func maxUint32(a, b uint32) uint32 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// TestPlanTiles checks that tiles cover the image and fit the memory limit.
+func TestPlanTiles(t *testing.T) {
+	for _, tc := range []struct {
+		width, height, scale, tileSize, workers int
+		memoryLimit                             int64
+		wantSize, wantTiles, wantConcurrency    int
+	}{
+		{800, 600, 4, 0, 4, 1 << 30, 800, 1, 1},
+		{800, 600, 4, 512, 4, 1 << 30, 512, 4, 4},
+		{800, 600, 4, 512, 8, 1 << 30, 512, 4, 4},
+		{800, 600, 4, 512, 4, 64 << 20, 256, 12, 3},
+		{800, 600, 4, 512, 4, 1, 64, 130, 1},
+	} {
+		o := defaultOptions()
+		o.width, o.height, o.scale = tc.width, tc.height, tc.scale
+		o.tileSize, o.workers, o.memoryLimit = tc.tileSize, tc.workers, tc.memoryLimit
+		plan := planTiles(o)
+		if plan.size != tc.wantSize || len(plan.tiles) != tc.wantTiles || plan.concurrency != tc.wantConcurrency {
+			t.Errorf("%+v: want size %d, %d tiles, concurrency %d: got %d, %d, %d", tc,
+				tc.wantSize, tc.wantTiles, tc.wantConcurrency, plan.size, len(plan.tiles), plan.concurrency)
+		}
+		covered := 0
+		for _, tl := range plan.tiles {
+			covered += tl.rect.Dx() * tl.rect.Dy()
+		}
+		if covered != tc.width*tc.height {
+			t.Errorf("%+v: tiles cover %d pixels: want %d", tc, covered, tc.width*tc.height)
+		}
+	}
+}
+
+// BenchmarkRender compares rendering a scan in a single context with rendering it in tiles.
+func BenchmarkRender(b *testing.B) {
+	systems := testSystems(2000)
+	opts := []Option{WithImageSize(1600, 1600), WithSupersampling(4)}
+
+	b.Run("single", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := Render(systems, append(opts, WithTileSize(0), WithWorkers(1))...); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	for workers := 1; workers <= runtime.NumCPU(); workers++ {
+		b.Run(fmt.Sprintf("tiled-%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := Render(systems, append(opts, WithWorkers(workers))...); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestSystemLabel(t *testing.T) {
+	sys := &mem.System{Id: 7, Name: "Sol", X: 1, Y: -2, Z: 3, Planets: []mem.Planet{{Orbit: 1}}}
+	for _, tc := range []struct {
+		labels, coordinates, counts bool
+		want                        string
+	}{
+		{false, false, false, ""},
+		{true, false, false, "Sol"},
+		{true, true, false, "1,-2,3"},
+		{false, false, true, "1 planet"},
+		{true, false, true, "Sol (1 planet)"},
+		{true, true, true, "1,-2,3 (1 planet)"},
+	} {
+		o := defaultOptions()
+		o.labels, o.coordinates, o.planetCounts = tc.labels, tc.coordinates, tc.counts
+		if got := systemLabel(sys, o); got != tc.want {
+			t.Errorf("%+v: want %q: got %q", tc, tc.want, got)
+		}
+	}
+	if got := systemLabel(&mem.System{Id: 7}, &options{labels: true, planetCounts: true}); got != "7 (0 planets)" {
+		t.Errorf("unnamed: want %q: got %q", "7 (0 planets)", got)
+	}
+}
@@ -0,0 +1,304 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package scan
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/fogleman/ln/ln"
+	"github.com/mdhender/lutymaps/pkg/stores/mem"
+	"image"
+	"image/draw"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Axis is the axis that a sector is sliced along.
+type Axis string
+
+const (
+	AxisX Axis = "x"
+	AxisY Axis = "y"
+	AxisZ Axis = "z"
+)
+
+// sliceMargin is the space, in pixels, around a slice for the axis labels.
+const sliceMargin = 40
+
+// sliceTick is the distance, in galaxy units, between labeled grid lines on a slice.
+const sliceTick = 5
+
+// Slice is a top-down map of one layer of a sector.
+type Slice struct {
+	Axis    Axis
+	From    int // first coordinate of the layer along the axis
+	To      int // last coordinate of the layer along the axis
+	Systems int // number of systems in the layer
+	drawing *drawing
+}
+
+// Image returns the map as an image.
+func (s *Slice) Image() image.Image {
+	return s.drawing.image()
+}
+
+// WriteSVG writes the map as an SVG document.
+func (s *Slice) WriteSVG(w io.Writer) error {
+	return s.drawing.writeSVG(w)
+}
+
+// Slices cuts the systems into layers along the slice axis and maps each layer.
+// Every map has the same frame, which is the slice bounds if they are set
+// or the smallest box that holds all the systems if they aren't,
+// so that a system keeps its place on the page from one layer to the next.
+func Slices(systems mem.Systems, opts ...Option) ([]*Slice, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// a is the slice axis; u and v are the horizontal and vertical axes of the map
+	var a, u, v int
+	switch o.sliceAxis {
+	case AxisX:
+		a, u, v = 0, 1, 2
+	case AxisY:
+		a, u, v = 1, 0, 2
+	default:
+		a, u, v = 2, 0, 1
+	}
+	coord := func(sys *mem.System, i int) int {
+		return [3]int{sys.X, sys.Y, sys.Z}[i]
+	}
+
+	var list mem.Systems
+	for _, sys := range systems {
+		if sys != nil {
+			list = append(list, sys)
+		}
+	}
+	lo, hi := o.sliceMin, o.sliceMax
+	if !o.sliceBounded {
+		if len(list) == 0 {
+			return nil, nil
+		}
+		for i := 0; i < 3; i++ {
+			lo[i], hi[i] = math.MaxInt, math.MinInt
+			for _, sys := range list {
+				lo[i], hi[i] = minInt(lo[i], coord(sys, i)), maxInt(hi[i], coord(sys, i))
+			}
+		}
+	}
+
+	// map galaxy coordinates to pixels, centering the frame in the space inside the margins
+	width, height := float64(o.width), float64(o.height)
+	cols, rows := float64(hi[u]-lo[u]+1), float64(hi[v]-lo[v]+1)
+	scale := math.Max(1, math.Min((width-2*sliceMargin)/cols, (height-2*sliceMargin)/rows))
+	ox := (width - cols*scale) / 2
+	oy := (height - rows*scale) / 2
+	px := func(n float64) float64 { return ox + (n-float64(lo[u])+0.5)*scale }
+	py := func(n float64) float64 { return oy + (n-float64(lo[v])+0.5)*scale }
+
+	// the grid is the same on every slice; lines run through the coordinates
+	// so that systems sit on the lines and the ticks label the lines
+	left, right := px(float64(lo[u])-0.5), px(float64(hi[u])+0.5)
+	bottom, top := py(float64(lo[v])-0.5), py(float64(hi[v])+0.5)
+	minor := ln.Paths{}
+	major := ln.Paths{{{X: left, Y: bottom}, {X: right, Y: bottom}, {X: right, Y: top}, {X: left, Y: top}, {X: left, Y: bottom}}}
+	for n := lo[u]; n <= hi[u]; n++ {
+		line := ln.Path{{X: px(float64(n)), Y: bottom}, {X: px(float64(n)), Y: top}}
+		if n%sliceTick == 0 {
+			major = append(major, line)
+		} else {
+			minor = append(minor, line)
+		}
+	}
+	for n := lo[v]; n <= hi[v]; n++ {
+		line := ln.Path{{X: left, Y: py(float64(n))}, {X: right, Y: py(float64(n))}}
+		if n%sliceTick == 0 {
+			major = append(major, line)
+		} else {
+			minor = append(minor, line)
+		}
+	}
+	var axisLabels []label
+	names := [3]string{"x", "y", "z"}
+	for n := lo[u]; n <= hi[u]; n++ {
+		if n%sliceTick == 0 {
+			axisLabels = append(axisLabels, label{x: px(float64(n)), y: oy - 14, text: strconv.Itoa(n), color: o.color, align: 0.5})
+		}
+	}
+	for n := lo[v]; n <= hi[v]; n++ {
+		if n%sliceTick == 0 {
+			axisLabels = append(axisLabels, label{x: ox - 4, y: py(float64(n)) - 4, text: strconv.Itoa(n), color: o.color, align: 1})
+		}
+	}
+	axisLabels = append(axisLabels,
+		label{x: px(float64(hi[u])) + scale, y: oy - 28, text: names[u], color: o.color, align: 0.5},
+		label{x: ox - 4, y: py(float64(hi[v])) + scale, text: names[v], color: o.color, align: 1},
+	)
+
+	from, to := lo[a], hi[a]
+	if o.sliceLevels {
+		from, to = o.sliceFrom, o.sliceTo
+	}
+	var slices []*Slice
+	for level := from; level <= to; level += o.sliceThickness {
+		// check the sums against the largest int before adding so that levels can't overflow
+		s := &Slice{Axis: Axis(names[a]), From: level, To: to}
+		if level <= math.MaxInt-(o.sliceThickness-1) && level+o.sliceThickness-1 < to {
+			s.To = level + o.sliceThickness - 1
+		}
+		d := &drawing{width: width, height: height, background: o.background}
+		if scale >= 4 {
+			// minor lines would be a solid block when the cells are tiny
+			d.layers = append(d.layers, layer{color: o.color.MulScalar(0.5), paths: minor})
+		}
+		d.layers = append(d.layers, layer{color: o.color, paths: major})
+		d.labels = append(d.labels, axisLabels...)
+		title := fmt.Sprintf("%s = %d", s.Axis, s.From)
+		if s.To != s.From {
+			title = fmt.Sprintf("%s = %d..%d", s.Axis, s.From, s.To)
+		}
+		d.labels = append(d.labels, label{x: width / 2, y: height - 20, text: title, color: o.color, align: 0.5})
+
+		glyphs := make(map[mem.SystemKind]ln.Paths)
+		for _, sys := range list {
+			n := coord(sys, a)
+			if n < s.From || n > s.To || coord(sys, u) < lo[u] || coord(sys, u) > hi[u] || coord(sys, v) < lo[v] || coord(sys, v) > hi[v] {
+				continue
+			}
+			s.Systems++
+			style := o.styles.Lookup(sys.Kind)
+			x, y := px(float64(coord(sys, u))), py(float64(coord(sys, v)))
+			glyphs[sys.Kind] = append(glyphs[sys.Kind], glyph(style.Shape, x, y, math.Max(1.5, style.Size*scale)))
+			if text := systemLabel(sys, o); text != "" {
+				d.labels = append(d.labels, label{x: x + style.Size*scale + 2, y: y, text: text, color: style.color()})
+			}
+		}
+		var kinds []mem.SystemKind
+		for kind := range glyphs {
+			kinds = append(kinds, kind)
+		}
+		sort.Slice(kinds, func(i, j int) bool { return kinds[i] < kinds[j] })
+		for _, kind := range kinds {
+			d.layers = append(d.layers, layer{color: o.styles.Lookup(kind).color(), paths: glyphs[kind]})
+		}
+
+		s.drawing = d
+		slices = append(slices, s)
+		if level > math.MaxInt-o.sliceThickness || level+o.sliceThickness > to {
+			break
+		}
+	}
+	return slices, nil
+}
+
+// glyph returns the outline used to mark a system on a slice.
+// Each shape has its own glyph so that kinds can be told apart in print.
+func glyph(shape Shape, x, y, r float64) ln.Path {
+	var sides int
+	var rotation float64
+	switch shape {
+	case ShapeCone:
+		sides, rotation = 3, math.Pi/2
+	case ShapeCube:
+		sides, rotation = 4, math.Pi/4
+	case ShapeIcosahedron:
+		sides = 6
+	default:
+		sides = 24
+	}
+	var path ln.Path
+	for i := 0; i <= sides; i++ {
+		theta := rotation + 2*math.Pi*float64(i)/float64(sides)
+		path = append(path, ln.Vector{X: x + r*math.Cos(theta), Y: y + r*math.Sin(theta)})
+	}
+	return path
+}
+
+// ContactSheet returns one image with the slices laid out in rows,
+// from left to right and top to bottom.
+func ContactSheet(slices []*Slice) image.Image {
+	if len(slices) == 0 {
+		return image.NewRGBA(image.Rect(0, 0, 0, 0))
+	}
+	columns := sheetColumns(len(slices))
+	w, h := int(slices[0].drawing.width), int(slices[0].drawing.height)
+	rows := (len(slices) + columns - 1) / columns
+	sheet := image.NewRGBA(image.Rect(0, 0, columns*w, rows*h))
+	draw.Draw(sheet, sheet.Bounds(), image.NewUniform(slices[0].drawing.background.NRGBA()), image.Point{}, draw.Src)
+	for i, s := range slices {
+		x, y := (i%columns)*w, (i/columns)*h
+		draw.Draw(sheet, image.Rect(x, y, x+w, y+h), s.Image(), image.Point{}, draw.Src)
+	}
+	return sheet
+}
+
+// WriteContactSheetSVG writes the slices as one SVG document,
+// laid out like ContactSheet.
+func WriteContactSheetSVG(w io.Writer, slices []*Slice) error {
+	if len(slices) == 0 {
+		return fmt.Errorf("scan: no slices")
+	}
+	columns := sheetColumns(len(slices))
+	width, height := slices[0].drawing.width, slices[0].drawing.height
+	rows := (len(slices) + columns - 1) / columns
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "<svg xmlns=\"http://www.w3.org/2000/svg\" version=\"1.1\" width=\"%g\" height=\"%g\" viewBox=\"0 0 %g %g\">\n",
+		float64(columns)*width, float64(rows)*height, float64(columns)*width, float64(rows)*height)
+	for i, s := range slices {
+		x, y := float64(i%columns)*width, float64(i/columns)*height
+		fmt.Fprintf(bw, "<svg x=\"%g\" y=\"%g\" width=\"%g\" height=\"%g\">\n", x, y, width, height)
+		s.drawing.writeSVGElements(bw)
+		bw.WriteString("</svg>\n")
+	}
+	bw.WriteString("</svg>\n")
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("scan: %w", err)
+	}
+	return nil
+}
+
+// sheetColumns returns the number of columns for a roughly square contact sheet.
+func sheetColumns(n int) int {
+	return int(math.Ceil(math.Sqrt(float64(n))))
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,196 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package scan
+
+import (
+	"encoding/json"
+	"fmt"
+	gl "github.com/fogleman/fauxgl"
+	"github.com/mdhender/lutymaps/pkg/stores/mem"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Shape is the mesh used to draw a system.
+type Shape string
+
+const (
+	ShapeCone        Shape = "cone"
+	ShapeCube        Shape = "cube"
+	ShapeIcosahedron Shape = "icosahedron"
+	ShapeSphere      Shape = "sphere"
+)
+
+// Style describes how a system is drawn.
+type Style struct {
+	Color     string  `json:"color" yaml:"color"`         // hex color
+	Alpha     float64 `json:"alpha" yaml:"alpha"`         // 0 is transparent, 1 is opaque
+	Size      float64 `json:"size" yaml:"size"`           // scale applied to the mesh
+	Shape     Shape   `json:"shape" yaml:"shape"`         // mesh shape
+	Wireframe bool    `json:"wireframe" yaml:"wireframe"` // draw the mesh outline
+}
+
+// Styles maps system kinds to their style.
+type Styles map[mem.SystemKind]Style
+
+// DefaultStyle is used for kinds that are missing from the style table.
+var DefaultStyle = Style{Color: "#9DFFFF", Alpha: 0.75, Size: 0.4, Shape: ShapeSphere, Wireframe: true}
+
+// DefaultStyles returns the default style table.
+func DefaultStyles() Styles {
+	return Styles{
+		mem.SKEmpty:              {Color: "#808080", Alpha: 0.25, Size: 0.1, Shape: ShapeSphere},
+		mem.SKBlueSuperGiant:     {Color: "#9DB4FF", Alpha: 1, Size: 0.6, Shape: ShapeSphere},
+		mem.SKDenseDustCloud:     {Color: "#8B6B4A", Alpha: 0.75, Size: 0.5, Shape: ShapeIcosahedron, Wireframe: true},
+		mem.SKMediumDustCloud:    {Color: "#A58B6F", Alpha: 0.5, Size: 0.45, Shape: ShapeIcosahedron, Wireframe: true},
+		mem.SKYellowMainSequence: {Color: "#FFE066", Alpha: 1, Size: 0.4, Shape: ShapeSphere},
+		mem.SKLightDustCloud:     {Color: "#C8B89F", Alpha: 0.25, Size: 0.4, Shape: ShapeIcosahedron, Wireframe: true},
+	}
+}
+
+// Lookup returns the style for the kind.
+// If the kind is not in the table, it returns DefaultStyle.
+func (s Styles) Lookup(kind mem.SystemKind) Style {
+	if style, ok := s[kind]; ok {
+		return style
+	}
+	return DefaultStyle
+}
+
+// LoadStyles loads a style table from a JSON or YAML file.
+// The file maps kind names to styles, for example
+//
+//	{"Blue Super Giant": {"color": "#9DB4FF", "alpha": 1, "size": 0.6, "shape": "sphere"}}
+//
+// Kinds missing from the file keep their default style,
+// and fields missing from an entry keep the default value for that kind.
+func LoadStyles(path string) (Styles, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("styles: %w", err)
+	}
+
+	styles := DefaultStyles()
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		var entries map[string]json.RawMessage
+		if err = json.Unmarshal(buf, &entries); err != nil {
+			return nil, fmt.Errorf("styles: %w", err)
+		}
+		for name, entry := range entries {
+			kind, ok := mem.ParseSystemKind(name)
+			if !ok {
+				return nil, fmt.Errorf("styles: %q: unknown kind", name)
+			}
+			style := styles.Lookup(kind)
+			if err = json.Unmarshal(entry, &style); err != nil {
+				return nil, fmt.Errorf("styles: %q: %w", name, err)
+			}
+			styles[kind] = style
+		}
+	case ".yaml", ".yml":
+		var entries map[string]yaml.Node
+		if err = yaml.Unmarshal(buf, &entries); err != nil {
+			return nil, fmt.Errorf("styles: %w", err)
+		}
+		for name, entry := range entries {
+			kind, ok := mem.ParseSystemKind(name)
+			if !ok {
+				return nil, fmt.Errorf("styles: %q: unknown kind", name)
+			}
+			style := styles.Lookup(kind)
+			if err = entry.Decode(&style); err != nil {
+				return nil, fmt.Errorf("styles: %q: %w", name, err)
+			}
+			styles[kind] = style
+		}
+	default:
+		return nil, fmt.Errorf("styles: %q: unsupported file type %q", path, ext)
+	}
+
+	for kind, style := range styles {
+		if err = style.validate(); err != nil {
+			return nil, fmt.Errorf("styles: %q: %w", kind, err)
+		}
+	}
+
+	return styles, nil
+}
+
+// validate returns an error if the style can't be rendered.
+func (s Style) validate() error {
+	switch s.Shape {
+	case ShapeCone, ShapeCube, ShapeIcosahedron, ShapeSphere:
+	default:
+		return fmt.Errorf("unknown shape %q", s.Shape)
+	}
+	if s.Alpha < 0 || s.Alpha > 1 {
+		return fmt.Errorf("alpha must be between 0 and 1: %g", s.Alpha)
+	}
+	if s.Size <= 0 {
+		return fmt.Errorf("size must be positive: %g", s.Size)
+	}
+	return nil
+}
+
+// color returns the shader color for the style.
+func (s Style) color() gl.Color {
+	return gl.HexColor(s.Color).Alpha(s.Alpha)
+}
+
+// meshes caches the mesh for each shape so that it is built only once.
+var meshes = struct {
+	sync.Mutex
+	cache map[Shape]*gl.Mesh
+}{cache: make(map[Shape]*gl.Mesh)}
+
+// newMesh returns a copy of the mesh for the shape, centered on the origin with a radius of about 1.
+func newMesh(shape Shape) (*gl.Mesh, error) {
+	meshes.Lock()
+	mesh, ok := meshes.cache[shape]
+	if !ok {
+		switch shape {
+		case ShapeCone:
+			mesh = gl.NewCone(15, true)
+		case ShapeCube:
+			mesh = gl.NewCube()
+		case ShapeIcosahedron:
+			mesh = gl.NewIcosahedron()
+		case ShapeSphere:
+			mesh = gl.NewSphere(2)
+			mesh.SmoothNormals()
+		default:
+			meshes.Unlock()
+			return nil, fmt.Errorf("unknown shape %q", shape)
+		}
+		meshes.cache[shape] = mesh
+	}
+	meshes.Unlock()
+	// cached meshes are never changed, so they can be copied without the lock
+	return mesh.Copy(), nil
+}
@@ -0,0 +1,284 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package scan
+
+import (
+	"fmt"
+	gl "github.com/fogleman/fauxgl"
+	"github.com/nfnt/resize"
+	"image"
+	"image/draw"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	minTileSize      = 64 // smallest tile the planner will shrink to, in output pixels
+	bytesPerSubpixel = 16 // color and depth buffers plus the down-sampling scratch space
+	tileMargin       = 2  // extra output pixels around a triangle when binning it
+)
+
+// tile is a rectangle of the output image, in output pixels, that is rendered in its own context.
+type tile struct {
+	rect image.Rectangle // pixels copied to the output image
+	pad  int             // pixels rendered around rect so down-sampling matches at the seams
+}
+
+// tilePlan describes how an image is split into tiles.
+type tilePlan struct {
+	size        int    // tile width and height in output pixels
+	tiles       []tile // tiles in row order
+	concurrency int    // number of tiles rendered at the same time
+}
+
+// planTiles splits the output image into tiles that fit the memory limit.
+// The tile size is halved until one tile fits, and as many tiles are
+// rendered at once as fit in the limit, up to the number of workers.
+// A tile size of zero renders the image as a single tile.
+func planTiles(o *options) tilePlan {
+	if o.tileSize == 0 {
+		return tilePlan{
+			size:        maxInt(o.width, o.height),
+			tiles:       []tile{{rect: image.Rect(0, 0, o.width, o.height)}},
+			concurrency: 1,
+		}
+	}
+
+	cost := func(size int) int64 {
+		side := int64(size+2) * int64(o.scale)
+		return side * side * bytesPerSubpixel
+	}
+	size := minInt(o.tileSize, maxInt(o.width, o.height))
+	for size > minTileSize && cost(size) > o.memoryLimit {
+		size = maxInt(size/2, minTileSize)
+	}
+
+	var tiles []tile
+	for y := 0; y < o.height; y += size {
+		for x := 0; x < o.width; x += size {
+			r := image.Rect(x, y, minInt(x+size, o.width), minInt(y+size, o.height))
+			tiles = append(tiles, tile{rect: r, pad: 1})
+		}
+	}
+
+	concurrency := int(o.memoryLimit / cost(size))
+	if concurrency > o.workers {
+		concurrency = o.workers
+	}
+	if concurrency > len(tiles) {
+		concurrency = len(tiles)
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return tilePlan{size: size, tiles: tiles, concurrency: concurrency}
+}
+
+// pass is the part of a scene that is drawn in one color.
+// Triangles are shaded; lines are shaded like the triangles they outline,
+// or drawn in a solid color if the pass has no triangles.
+type pass struct {
+	triangles []*gl.Triangle
+	lines     []*gl.Line
+	color     gl.Color
+	lineWidth float64 // in supersampled pixels
+}
+
+// outline returns the edges of the triangles that face the eye.
+// Outlines are drawn as lines rather than in wireframe mode because
+// a triangle clipped at the edge of a tile would be outlined in pieces.
+func outline(triangles []*gl.Triangle, eye gl.Vector) []*gl.Line {
+	var lines []*gl.Line
+	for _, t := range triangles {
+		normal := t.V2.Position.Sub(t.V1.Position).Cross(t.V3.Position.Sub(t.V1.Position))
+		if eye.Sub(t.V1.Position).Dot(normal) <= 0 {
+			continue
+		}
+		lines = append(lines, gl.NewLine(t.V1, t.V2), gl.NewLine(t.V2, t.V3), gl.NewLine(t.V3, t.V1))
+	}
+	return lines
+}
+
+// bin assigns the triangles and lines of each pass to the tiles they might cover.
+// The result is indexed by tile and then by pass.
+// Shapes that cross the plane of the camera can't be projected, so they go to every tile.
+func bin(plan tilePlan, matrix gl.Matrix, width, height int, passes []pass) [][]pass {
+	bins := make([][]pass, len(plan.tiles))
+	if len(plan.tiles) == 1 {
+		bins[0] = passes
+		return bins
+	}
+	for i := range bins {
+		bins[i] = make([]pass, len(passes))
+		for j, p := range passes {
+			bins[i][j] = pass{color: p.color, lineWidth: p.lineWidth}
+		}
+	}
+
+	columns := (width + plan.size - 1) / plan.size
+	rows := (height + plan.size - 1) / plan.size
+	w, h := float64(width), float64(height)
+	// tiles returns the range of tiles that the points might cover
+	tiles := func(points ...gl.Vector) (c0, r0, c1, r1 int) {
+		x0, y0, x1, y1 := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+		for _, v := range points {
+			p := matrix.MulPositionW(v)
+			if p.W <= 0 {
+				return 0, 0, columns - 1, rows - 1
+			}
+			px, py := (p.X/p.W+1)*w/2, (1-p.Y/p.W)*h/2
+			x0, y0 = math.Min(x0, px), math.Min(y0, py)
+			x1, y1 = math.Max(x1, px), math.Max(y1, py)
+		}
+		c0 = maxInt(int(math.Floor((x0-tileMargin)/float64(plan.size))), 0)
+		c1 = minInt(int(math.Floor((x1+tileMargin)/float64(plan.size))), columns-1)
+		r0 = maxInt(int(math.Floor((y0-tileMargin)/float64(plan.size))), 0)
+		r1 = minInt(int(math.Floor((y1+tileMargin)/float64(plan.size))), rows-1)
+		return c0, r0, c1, r1
+	}
+	for j, p := range passes {
+		for _, t := range p.triangles {
+			c0, r0, c1, r1 := tiles(t.V1.Position, t.V2.Position, t.V3.Position)
+			for r := r0; r <= r1; r++ {
+				for c := c0; c <= c1; c++ {
+					i := r*columns + c
+					bins[i][j].triangles = append(bins[i][j].triangles, t)
+				}
+			}
+		}
+		for _, line := range p.lines {
+			c0, r0, c1, r1 := tiles(line.V1.Position, line.V2.Position)
+			for r := r0; r <= r1; r++ {
+				for c := c0; c <= c1; c++ {
+					i := r*columns + c
+					bins[i][j].lines = append(bins[i][j].lines, line)
+				}
+			}
+		}
+	}
+	return bins
+}
+
+// render draws the scene from the camera in the options.
+// The image is split into tiles that are rendered concurrently and then stitched together.
+func (sc *scene) render(o *options) (image.Image, error) {
+	start := time.Now()
+
+	// the grid and the axes are drawn first so that the systems blend over them,
+	// then the systems in kind order
+	var passes []pass
+	if len(sc.grid) != 0 {
+		passes = append(passes, pass{lines: sc.grid, color: o.color, lineWidth: float64(o.scale)})
+	}
+	for a, axis := range sc.axes {
+		if axis != nil {
+			passes = append(passes, pass{lines: []*gl.Line{axis}, color: axisColors[a], lineWidth: 2 * float64(o.scale)})
+		}
+	}
+	for _, kind := range sc.kinds {
+		style := o.styles.Lookup(kind)
+		p := pass{triangles: sc.meshes[kind].Triangles, color: style.color(), lineWidth: 2}
+		if style.Wireframe {
+			p.lines = outline(p.triangles, o.eye)
+		}
+		passes = append(passes, p)
+	}
+
+	aspect := float64(o.width) / float64(o.height)
+	view := gl.LookAt(o.eye, o.center, o.up)
+	matrix := view.Perspective(o.fovy, aspect, o.near, o.far)
+	plan := planTiles(o)
+	bins := bin(plan, matrix, o.width, o.height, passes)
+	fmt.Printf("scan: tiles: %d of %dx%d, %d at a time\n", len(plan.tiles), plan.size, plan.size, plan.concurrency)
+
+	dst := image.NewNRGBA(image.Rect(0, 0, o.width, o.height))
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < plan.concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				t := plan.tiles[i]
+				img := renderTile(o, view, t, bins[i])
+				draw.Draw(dst, t.rect, img, image.Pt(t.pad, t.pad), draw.Src)
+			}
+		}()
+	}
+	for i := range plan.tiles {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+	fmt.Printf("scan: stars: %5d: %v\n", sc.count, time.Since(start))
+
+	if err := drawMarkers(dst, sc.markers, matrix, o); err != nil {
+		return nil, fmt.Errorf("scan: labels: %w", err)
+	}
+	return dst, nil
+}
+
+// renderTile draws the passes binned to one tile and returns the down-sampled tile,
+// including its padding.
+func renderTile(o *options, view gl.Matrix, t tile, passes []pass) image.Image {
+	r := t.rect.Inset(-t.pad)
+	width, height := r.Dx(), r.Dy()
+
+	// create a rendering context
+	context := gl.NewContext(width*o.scale, height*o.scale)
+	context.ClearColorBufferWith(o.background)
+
+	// create transformation matrix for the part of the view frustum that the tile covers
+	ymax := o.near * math.Tan(o.fovy*math.Pi/360)
+	xmax := ymax * float64(o.width) / float64(o.height)
+	left := xmax * (2*float64(r.Min.X)/float64(o.width) - 1)
+	right := xmax * (2*float64(r.Max.X)/float64(o.width) - 1)
+	top := ymax * (1 - 2*float64(r.Min.Y)/float64(o.height))
+	bottom := ymax * (1 - 2*float64(r.Max.Y)/float64(o.height))
+	matrix := view.Frustum(left, right, bottom, top, o.near, o.far)
+
+	for _, p := range passes {
+		context.DepthBias = 0
+		if len(p.triangles) != 0 {
+			shader := gl.NewPhongShader(matrix, o.light, o.eye)
+			shader.ObjectColor = p.color
+			shader.SpecularPower = 0
+			context.Shader = shader
+			context.DrawTriangles(p.triangles)
+			// keep outlines in front of the triangles they outline
+			context.DepthBias = -0.00001
+		} else {
+			context.Shader = gl.NewSolidColorShader(matrix, p.color)
+		}
+		if len(p.lines) != 0 {
+			context.LineWidth = p.lineWidth
+			context.DrawLines(p.lines)
+		}
+	}
+
+	// down-sample image for antialiasing
+	return resize.Resize(uint(width), uint(height), context.Image(), resize.Bilinear)
+}
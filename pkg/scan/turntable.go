@@ -0,0 +1,135 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package scan
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/mdhender/lutymaps/pkg/stores/mem"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"math"
+	"os"
+	"time"
+)
+
+// Turntable renders the systems from cameras spaced evenly on a circle around the view center
+// and calls fn with each frame, in order. The first frame is the view from the camera in the
+// options, moved to the turntable elevation; the circle is at the same distance from the center
+// and turns around the up vector.
+// The meshes are built once, so this is much faster than rendering each frame on its own.
+func Turntable(systems mem.Systems, fn func(frame int, img image.Image) error, opts ...Option) error {
+	o, err := newOptions(opts)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	defer func(s time.Time) {
+		fmt.Printf("scan: turntable: %d frames: %v\n", o.frames, time.Since(s))
+	}(start)
+
+	sc, err := newScene(systems, o)
+	if err != nil {
+		return err
+	}
+
+	// w is the axis of the turntable; u and v span the plane it turns in,
+	// with u pointing from the center towards the camera
+	w := o.up.Normalize()
+	offset := o.eye.Sub(o.center)
+	distance := offset.Length()
+	h := offset.Sub(w.MulScalar(offset.Dot(w)))
+	if h.Length() < 1e-9 {
+		// the camera is on the axis, so any direction in the plane will do
+		h = w.Perpendicular()
+	}
+	u := h.Normalize()
+	v := w.Cross(u)
+	elevation := math.Atan2(offset.Dot(w), h.Length())
+	if o.elevationSet {
+		elevation = o.elevation * math.Pi / 180
+	}
+
+	frame := *o
+	for i := 0; i < o.frames; i++ {
+		azimuth := 2 * math.Pi * float64(i) / float64(o.frames)
+		direction := u.MulScalar(math.Cos(azimuth)).Add(v.MulScalar(math.Sin(azimuth))).MulScalar(math.Cos(elevation)).Add(w.MulScalar(math.Sin(elevation)))
+		frame.eye = o.center.Add(direction.MulScalar(distance))
+		img, err := sc.render(&frame)
+		if err != nil {
+			return err
+		}
+		if err = fn(i, img); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewTurntableGIF renders a turntable of the systems and saves it as an animated GIF to the path.
+// The animation loops forever.
+func NewTurntableGIF(systems mem.Systems, path string, opts ...Option) error {
+	o, err := newOptions(opts)
+	if err != nil {
+		return err
+	}
+
+	// the frames are kept as paletted images, which take a quarter of the memory
+	anim := &gif.GIF{}
+	delay := int(o.frameDelay / (10 * time.Millisecond)) // GIF delays are in 100ths of a second
+	err = Turntable(systems, func(frame int, img image.Image) error {
+		p := image.NewPaletted(img.Bounds(), palette.Plan9)
+		draw.FloydSteinberg.Draw(p, img.Bounds(), img, img.Bounds().Min)
+		anim.Image = append(anim.Image, p)
+		anim.Delay = append(anim.Delay, delay)
+		return nil
+	}, opts...)
+	if err != nil {
+		return err
+	}
+
+	fp, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("scan: %w", err)
+	}
+	bw := bufio.NewWriter(fp)
+	if err = gif.EncodeAll(bw, anim); err != nil {
+		_ = fp.Close()
+		return fmt.Errorf("scan: %w", err)
+	}
+	if err = bw.Flush(); err != nil {
+		_ = fp.Close()
+		return fmt.Errorf("scan: %w", err)
+	}
+	if err = fp.Close(); err != nil {
+		return fmt.Errorf("scan: %w", err)
+	}
+
+	fmt.Printf("scan: created %q\n", path)
+	return nil
+}
@@ -28,16 +28,40 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/go-chi/chi/v5"
+	"github.com/mdhender/lutymaps/pkg/stores/mem"
 	"net/http"
 )
 
-type Api struct{}
+type Api struct {
+	authn  Authentication
+	authz  Authorization
+	tokens Tokens
+	scans  chan struct{}     // one token per scan worker
+	store  func() *mem.Store // returns the current store
+}
 
 func (a *Api) Router() http.Handler {
 	r := chi.NewRouter()
 
 	r.Get("/", notImplemented)
 	r.Get("/echo", a.echoHandler())
+	r.Post("/login", a.postLogin())
+	r.Post("/logout", a.postLogout())
+	r.Post("/refresh", a.postRefresh())
+
+	// routes for authenticated accounts
+	r.Group(func(r chi.Router) {
+		r.Use(requireRole(a.authz, roleAuthenticated))
+		r.Get("/scan.png", a.getScan())
+		r.Get("/scan/slice.png", a.getSlice("png"))
+		r.Get("/scan/slice.svg", a.getSlice("svg"))
+		r.Get("/systems", a.listSystems())
+		r.Get("/systems/{id}", a.getSystem())
+		r.Get("/systems/{id}/planets", a.getPlanets())
+		r.Get("/systems/{x}/{y}/{z}", a.getSystemsAt())
+		r.Get("/sectors/box", a.getSectorBox())
+		r.Get("/sectors/sphere", a.getSectorSphere())
+	})
 
 	return r
 }
@@ -24,6 +24,8 @@
 
 package server
 
+import "time"
+
 // Authentication defines an interface for authenticating users.
 type Authentication interface {
 	// Authenticate accepts an id and secret.
@@ -31,3 +33,22 @@ type Authentication interface {
 	// Otherwise, it returns an empty string and false.
 	Authenticate(id, secret string) (string, bool)
 }
+
+// TokenAuthentication defines an interface for authenticating bearer tokens.
+type TokenAuthentication interface {
+	// AuthenticateToken accepts a bearer token.
+	// If the token is valid, it returns the authenticated id and true.
+	// Otherwise, it returns an empty string and false.
+	AuthenticateToken(token string) (string, bool)
+}
+
+// Tokens defines an interface for issuing and revoking bearer tokens.
+type Tokens interface {
+	TokenAuthentication
+	// Issue returns a new token for the id and the time that it expires.
+	Issue(id string) (string, time.Time, error)
+	// Refresh revokes the token and returns a new token for the same id.
+	Refresh(token string) (string, time.Time, error)
+	// Revoke revokes the token.
+	Revoke(token string)
+}
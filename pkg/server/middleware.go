@@ -0,0 +1,105 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package server
+
+import (
+	"context"
+	"net/http"
+)
+
+const (
+	authRealm         = `Basic realm="lutymaps"` // realm sent with authentication challenges
+	roleAuthenticated = "authenticated"          // role that every account should have
+)
+
+// contextKey is the type for values that the middleware stores in the request context.
+type contextKey string
+
+const accountIdKey = contextKey("account-id")
+
+// accountId returns the id of the account that authenticated the request.
+func accountId(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(accountIdKey).(string)
+	return id, ok && id != ""
+}
+
+// authenticator returns middleware that authenticates requests using either
+// HTTP Basic credentials or a bearer token from the Authorization header.
+// When the credentials are valid, the account id is added to the request context.
+// Requests without credentials are passed on anonymously;
+// requests with invalid credentials are rejected.
+func authenticator(authn Authentication, tokens TokenAuthentication) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var id string
+			var ok bool
+			if user, secret, isBasic := r.BasicAuth(); isBasic {
+				if authn != nil {
+					id, ok = authn.Authenticate(user, secret)
+				}
+			} else if token, isBearer := bearerToken(r); isBearer {
+				if tokens != nil {
+					id, ok = tokens.AuthenticateToken(token)
+				}
+			}
+			if !ok || id == "" {
+				unauthorized(w)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), accountIdKey, id)))
+		})
+	}
+}
+
+// requireRole returns middleware that rejects anonymous requests with 401
+// and requests from accounts without the role with 403.
+func requireRole(authz Authorization, role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, ok := accountId(r.Context())
+			if !ok {
+				unauthorized(w)
+				return
+			}
+			if authz == nil || !authz.Authorize(id)(role) {
+				writeError(w, http.StatusForbidden, "")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// unauthorized writes a 401 response with a challenge for Basic credentials.
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", authRealm)
+	writeError(w, http.StatusUnauthorized, "")
+}
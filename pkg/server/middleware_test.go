@@ -0,0 +1,213 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"github.com/mdhender/lutymaps/pkg/stores/mem"
+	"github.com/mdhender/lutymaps/pkg/tokens"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestStore returns a store with two accounts.
+// "player" has the authenticated role and "guest" has no roles.
+// The secret for both is "secret".
+func newTestStore(t *testing.T) *mem.Store {
+	t.Helper()
+	hashed, err := mem.HashSecret("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := mem.New()
+	for _, acct := range []mem.Account{
+		{Id: "1", UserId: "player", HashedSecret: hashed, Roles: map[string]bool{roleAuthenticated: true}},
+		{Id: "2", UserId: "guest", HashedSecret: hashed},
+	} {
+		if err = store.AddAccount(acct); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+// newTestServer returns the routes for a server using the store.
+func newTestServer(t *testing.T, store *mem.Store) (http.Handler, *tokens.Store) {
+	t.Helper()
+	tstore, err := tokens.New([]byte("0123456789abcdef0123456789abcdef"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(WithStore(store), WithTokens(tstore))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.Routes(), tstore
+}
+
+// do sends the request to the handler and returns the response.
+func do(h http.Handler, method, target, authorization, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if authorization != "" {
+		r.Header.Set("Authorization", authorization)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestMiddleware(t *testing.T) {
+	store := newTestStore(t)
+	tstore, err := tokens.New([]byte("0123456789abcdef0123456789abcdef"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	playerToken, _, err := tstore.Issue("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	guestToken, _, err := tstore.Issue("2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	revokedToken, _, err := tstore.Issue("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tstore.Revoke(revokedToken)
+
+	// the handler writes the account id from the context
+	h := authenticator(store, tstore)(requireRole(store, roleAuthenticated)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ := accountId(r.Context())
+		_, _ = w.Write([]byte(id))
+	})))
+
+	basic := func(user, secret string) string {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.SetBasicAuth(user, secret)
+		return r.Header.Get("Authorization")
+	}
+	for _, tc := range []struct {
+		name          string
+		authorization string
+		wantStatus    int
+		wantId        string
+	}{
+		{"anonymous", "", http.StatusUnauthorized, ""},
+		{"bad basic secret", basic("player", "wrong"), http.StatusUnauthorized, ""},
+		{"bad basic user", basic("nobody", "secret"), http.StatusUnauthorized, ""},
+		{"bad bearer", "Bearer garbage", http.StatusUnauthorized, ""},
+		{"revoked bearer", "Bearer " + revokedToken, http.StatusUnauthorized, ""},
+		{"other scheme", "Digest whatever", http.StatusUnauthorized, ""},
+		{"basic without role", basic("guest", "secret"), http.StatusForbidden, ""},
+		{"bearer without role", "Bearer " + guestToken, http.StatusForbidden, ""},
+		{"basic with role", basic("player", "secret"), http.StatusOK, "1"},
+		{"bearer with role", "Bearer " + playerToken, http.StatusOK, "1"},
+	} {
+		w := do(h, "GET", "/", tc.authorization, "")
+		if w.Code != tc.wantStatus {
+			t.Errorf("%s: want status %d: got %d", tc.name, tc.wantStatus, w.Code)
+		}
+		if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") != authRealm {
+			t.Errorf("%s: want challenge %q: got %q", tc.name, authRealm, w.Header().Get("WWW-Authenticate"))
+		}
+		if tc.wantStatus == http.StatusOK && w.Body.String() != tc.wantId {
+			t.Errorf("%s: want account id %q: got %q", tc.name, tc.wantId, w.Body.String())
+		}
+	}
+}
+
+func TestLoginRefreshLogout(t *testing.T) {
+	h, _ := newTestServer(t, newTestStore(t))
+	token := func(w *httptest.ResponseRecorder) string {
+		t.Helper()
+		var view tokenView
+		if err := json.Unmarshal(w.Body.Bytes(), &view); err != nil || view.Token == "" {
+			t.Fatalf("token: %v: %q", err, w.Body.String())
+		}
+		return view.Token
+	}
+
+	for _, tc := range []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"bad secret", `{"user-id":"player","secret":"wrong"}`, http.StatusUnauthorized},
+		{"unknown user", `{"user-id":"nobody","secret":"secret"}`, http.StatusUnauthorized},
+		{"bad body", `{"user-id":`, http.StatusBadRequest},
+	} {
+		if w := do(h, "POST", "/api/login", "", tc.body); w.Code != tc.wantStatus {
+			t.Errorf("login: %s: want status %d: got %d", tc.name, tc.wantStatus, w.Code)
+		}
+	}
+
+	w := do(h, "POST", "/api/login", "", `{"user-id":"player","secret":"secret"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("login: want status %d: got %d", http.StatusOK, w.Code)
+	}
+	first := token(w)
+	if w = do(h, "GET", "/api/systems", "Bearer "+first, ""); w.Code != http.StatusOK {
+		t.Errorf("systems: want status %d: got %d", http.StatusOK, w.Code)
+	}
+
+	// refreshing replaces the token
+	w = do(h, "POST", "/api/refresh", "Bearer "+first, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("refresh: want status %d: got %d", http.StatusOK, w.Code)
+	}
+	second := token(w)
+	if w = do(h, "GET", "/api/systems", "Bearer "+first, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("systems with old token: want status %d: got %d", http.StatusUnauthorized, w.Code)
+	}
+	if w = do(h, "POST", "/api/refresh", "Bearer "+first, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("refresh old token: want status %d: got %d", http.StatusUnauthorized, w.Code)
+	}
+	if w = do(h, "GET", "/api/systems", "Bearer "+second, ""); w.Code != http.StatusOK {
+		t.Errorf("systems with new token: want status %d: got %d", http.StatusOK, w.Code)
+	}
+
+	// logging out revokes the token
+	if w = do(h, "POST", "/api/logout", "Bearer "+second, ""); w.Code != http.StatusNoContent {
+		t.Errorf("logout: want status %d: got %d", http.StatusNoContent, w.Code)
+	}
+	if w = do(h, "GET", "/api/systems", "Bearer "+second, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("systems after logout: want status %d: got %d", http.StatusUnauthorized, w.Code)
+	}
+	if w = do(h, "POST", "/api/logout", "Bearer "+second, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("logout again: want status %d: got %d", http.StatusUnauthorized, w.Code)
+	}
+	if w = do(h, "POST", "/api/logout", "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("logout without token: want status %d: got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	// anonymous requests are rejected by the protected routes
+	if w = do(h, "GET", "/api/systems", "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("systems without token: want status %d: got %d", http.StatusUnauthorized, w.Code)
+	}
+}
@@ -24,6 +24,13 @@
 
 package server
 
+import (
+	"fmt"
+	"github.com/mdhender/lutymaps/pkg/stores/mem"
+	"io/fs"
+	"os"
+)
+
 type Option func(server *Server) error
 
 func WithAuthentication(authn Authentication) Option {
@@ -39,3 +46,49 @@ func WithAuthorization(authz Authorization) Option {
 		return nil
 	}
 }
+
+func WithTokens(tokens Tokens) Option {
+	return func(s *Server) error {
+		s.tokens = tokens
+		return nil
+	}
+}
+
+func WithStore(store *mem.Store) Option {
+	return func(s *Server) error {
+		s.store = store
+		return nil
+	}
+}
+
+// WithScanWorkers sets the number of scans that may be rendered at the same time.
+func WithScanWorkers(n int) Option {
+	return func(s *Server) error {
+		if n < 1 {
+			return fmt.Errorf("scan workers must be positive: %d", n)
+		}
+		s.scanWorkers = n
+		return nil
+	}
+}
+
+// WithPublicDir serves static files from the directory.
+func WithPublicDir(path string) Option {
+	return func(s *Server) error {
+		if sb, err := os.Stat(path); err != nil {
+			return err
+		} else if !sb.IsDir() {
+			return fmt.Errorf("%s: not a directory", path)
+		}
+		s.public = os.DirFS(path)
+		return nil
+	}
+}
+
+// WithPublicFS serves static files from the file system.
+func WithPublicFS(fsys fs.FS) Option {
+	return func(s *Server) error {
+		s.public = fsys
+		return nil
+	}
+}
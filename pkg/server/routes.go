@@ -58,26 +58,26 @@ func (s *Server) Routes() http.Handler {
 
 	// protected routes
 	r.Route("/api", func(r chi.Router) {
-		//r.Use(jwtauth.Verifier(tokenAuth)) // extract, verify, validate JWT
-		////r.Use(jwtauth.Authenticator)       // handle valid and invalid JWT
-		//r.Use(JWTAuthenticator)    // handle valid and invalid JWT
-		r.Mount("/", s.api.Router()) // mount the api sub-router
+		r.Use(authenticator(s.authn, s.tokens)) // add the account id to the request context
+		r.Mount("/", s.api.Router())            // mount the api sub-router
 	})
 
 	// static files
-	s.static = http.FileServer(http.Dir(s.public))
-	r.Get("/*", func(w http.ResponseWriter, r *http.Request) {
-		// osPath is the cleaned up path with our file system path separators
-		osPath := filepath.Clean(r.RequestURI)
-		// urlPath is the same but with url path separators
-		urlPath := strings.ReplaceAll(osPath, "\\", "/")
-		// verify that the request path in the url matches the cleaned up path
-		if r.RequestURI != urlPath { // forbid when there's a mismatch
-			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
-			return
-		}
-		s.static.ServeHTTP(w, r)
-	})
+	if s.public != nil {
+		s.static = http.FileServer(http.FS(s.public))
+		r.Get("/*", func(w http.ResponseWriter, r *http.Request) {
+			// osPath is the cleaned up path with our file system path separators
+			osPath := filepath.Clean(r.RequestURI)
+			// urlPath is the same but with url path separators
+			urlPath := strings.ReplaceAll(osPath, "\\", "/")
+			// verify that the request path in the url matches the cleaned up path
+			if r.RequestURI != urlPath { // forbid when there's a mismatch
+				http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+				return
+			}
+			s.static.ServeHTTP(w, r)
+		})
+	}
 
 	s.router = r
 	return r
@@ -0,0 +1,243 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	gl "github.com/fogleman/fauxgl"
+	"github.com/mdhender/lutymaps/pkg/scan"
+	"image"
+	"image/png"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	defaultScanSize = 800         // default width and height of a scan in pixels
+	maxScanSize     = 3200        // maximum width or height of a scan in pixels
+	maxScanPixels   = 4096 * 4096 // maximum size of the supersampled rendering context
+	defaultScanR    = 50.0        // default radius of a scanned sector
+	maxScanR        = 200.0       // maximum radius of a scanned sector; the whole sector is loaded for a scan
+	scanSupersample = 4           // preferred supersampling factor
+	maxSliceR       = 100.0       // maximum radius of a sliced sector; slices draw a line per coordinate
+	maxScanCoord    = 1 << 30     // maximum distance of a sector center from the origin on each axis
+	scanMemoryLimit = 64 << 20    // bytes of tile buffers used by each scan worker
+)
+
+// getScan renders a PNG scan of the sector centered on x, y, z with radius r.
+// The image is w pixels wide and h pixels high.
+// At most one scan per worker is rendered at a time;
+// other requests wait for a free worker.
+// Each scan is rendered on one goroutine in tiles that fit in scanMemoryLimit,
+// so the memory used by scans is bounded by the number of workers.
+func (a *Api) getScan() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		xyz, radius, size, err := sectorQuery(r.URL.Query())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if radius > maxScanR {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("r: not a positive number up to %g", maxScanR))
+			return
+		}
+
+		// reduce supersampling for large images to bound the memory used by each worker
+		supersample := scanSupersample
+		for supersample > 1 && size[0]*size[1]*supersample*supersample > maxScanPixels {
+			supersample--
+		}
+
+		// look at the center from the same direction as the scan command
+		center := gl.V(float64(xyz[0]), float64(xyz[1]), float64(xyz[2]))
+		eye := center.Add(gl.V(radius, radius, 0))
+		far := eye.Distance(center) + radius + 1
+
+		if !a.acquireScan(r) {
+			return
+		}
+		defer a.releaseScan()
+
+		img, err := scan.Render(a.store().WithinRadius(xyz[0], xyz[1], xyz[2], radius),
+			scan.WithImageSize(size[0], size[1]),
+			scan.WithSupersampling(supersample),
+			scan.WithCamera(eye, center, gl.V(0, 0, 1)),
+			scan.WithProjection(60, 1, far),
+			scan.WithOrigin(center), // the axes cross at the center of the sector
+			scan.WithWorkers(1),
+			scan.WithMemoryLimit(scanMemoryLimit),
+		)
+		if err != nil {
+			log.Printf("api: scan: %v\n", err)
+			writeError(w, http.StatusInternalServerError, "")
+			return
+		}
+		writePNG(w, img)
+	}
+}
+
+// getSlice renders a top-down map of one layer of the sector centered on x, y, z with radius r.
+// The layer is at coordinate level on the axis, which is z if not given.
+// The map is a PNG, or SVG if format is "svg", and is w pixels wide and h pixels high.
+func (a *Api) getSlice(format string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		xyz, radius, size, err := sectorQuery(q)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		axis := scan.AxisZ
+		if s := q.Get("axis"); s != "" {
+			axis = scan.Axis(s)
+			if axis != scan.AxisX && axis != scan.AxisY && axis != scan.AxisZ {
+				writeError(w, http.StatusBadRequest, "axis: not x, y or z")
+				return
+			}
+		}
+		if radius > maxSliceR {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("r: not a positive number up to %g", maxSliceR))
+			return
+		}
+		level, err := strconv.Atoi(q.Get("level"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "level: not an integer")
+			return
+		}
+		// the frame is the box around the sector so that every layer lines up
+		n := int(math.Ceil(radius))
+		center := xyz[2]
+		if axis == scan.AxisX {
+			center = xyz[0]
+		} else if axis == scan.AxisY {
+			center = xyz[1]
+		}
+		if level < center-n || level > center+n {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("level: not between %d and %d", center-n, center+n))
+			return
+		}
+
+		if !a.acquireScan(r) {
+			return
+		}
+		defer a.releaseScan()
+
+		slices, err := scan.Slices(a.store().WithinRadius(xyz[0], xyz[1], xyz[2], radius),
+			scan.WithImageSize(size[0], size[1]),
+			scan.WithSliceAxis(axis),
+			scan.WithSliceBounds(xyz[0]-n, xyz[1]-n, xyz[2]-n, xyz[0]+n, xyz[1]+n, xyz[2]+n),
+			scan.WithSliceLevels(level, level),
+		)
+		if err != nil {
+			log.Printf("api: slice: %v\n", err)
+			writeError(w, http.StatusInternalServerError, "")
+			return
+		} else if len(slices) != 1 {
+			log.Printf("api: slice: want 1 slice: got %d\n", len(slices))
+			writeError(w, http.StatusInternalServerError, "")
+			return
+		}
+
+		if format == "svg" {
+			buf := &bytes.Buffer{}
+			if err = slices[0].WriteSVG(buf); err != nil {
+				log.Printf("api: slice: %v\n", err)
+				writeError(w, http.StatusInternalServerError, "")
+				return
+			}
+			w.Header().Set("Content-Type", "image/svg+xml")
+			w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+			_, _ = w.Write(buf.Bytes())
+			return
+		}
+		writePNG(w, slices[0].Image())
+	}
+}
+
+// sectorQuery returns the center, radius and image size from the query.
+// Missing values are given their defaults.
+func sectorQuery(q url.Values) (xyz [3]int, radius float64, size [2]int, err error) {
+	for i, key := range []string{"x", "y", "z"} {
+		if s := q.Get(key); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < -maxScanCoord || n > maxScanCoord {
+				return xyz, 0, size, fmt.Errorf("%s: not an integer from %d to %d", key, -maxScanCoord, maxScanCoord)
+			}
+			xyz[i] = n
+		}
+	}
+	radius = defaultScanR
+	if s := q.Get("r"); s != "" {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil || !(f > 0) || math.IsInf(f, 0) {
+			return xyz, 0, size, fmt.Errorf("r: not a positive number")
+		}
+		radius = f
+	}
+	size = [2]int{defaultScanSize, defaultScanSize}
+	for i, key := range []string{"w", "h"} {
+		if s := q.Get(key); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 || n > maxScanSize {
+				return xyz, 0, size, fmt.Errorf("%s: not an integer from 1 to %d", key, maxScanSize)
+			}
+			size[i] = n
+		}
+	}
+	return xyz, radius, size, nil
+}
+
+// acquireScan waits for a free scan worker.
+// It returns false if the request is canceled first.
+func (a *Api) acquireScan(r *http.Request) bool {
+	select {
+	case a.scans <- struct{}{}:
+		return true
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+// releaseScan frees the scan worker taken by acquireScan.
+func (a *Api) releaseScan() {
+	<-a.scans
+}
+
+// writePNG writes the image as the PNG response.
+func writePNG(w http.ResponseWriter, img image.Image) {
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, img); err != nil {
+		log.Printf("api: png: %v\n", err)
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	_, _ = w.Write(buf.Bytes())
+}
@@ -0,0 +1,67 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestScanLimits(t *testing.T) {
+	h, tstore := newTestServer(t, newTestStore(t))
+	token, _, err := tstore.Issue("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		target     string
+		wantStatus int
+	}{
+		{"/api/scan.png?w=16&h=16", http.StatusOK},
+		{fmt.Sprintf("/api/scan.png?w=16&h=16&r=%g", maxScanR), http.StatusOK},
+		{fmt.Sprintf("/api/scan.png?w=16&h=16&r=%g", maxScanR+0.5), http.StatusBadRequest},
+		{"/api/scan.png?w=16&h=16&r=1e9", http.StatusBadRequest},
+		{"/api/scan.png?w=16&h=16&r=0", http.StatusBadRequest},
+		{"/api/scan.png?w=16&h=16&r=-1", http.StatusBadRequest},
+		{"/api/scan.png?w=16&h=16&r=NaN", http.StatusBadRequest},
+		{"/api/scan.png?w=16&h=16&r=Inf", http.StatusBadRequest},
+		{fmt.Sprintf("/api/scan.png?w=%d&h=16", maxScanSize+1), http.StatusBadRequest},
+		{"/api/scan.png?w=0&h=16", http.StatusBadRequest},
+		{fmt.Sprintf("/api/scan.png?w=16&h=16&x=%d", maxScanCoord+1), http.StatusBadRequest},
+		{"/api/scan.png?w=16&h=16&y=north", http.StatusBadRequest},
+		{fmt.Sprintf("/api/scan/slice.png?w=16&h=16&level=0&r=%g", maxSliceR), http.StatusOK},
+		{fmt.Sprintf("/api/scan/slice.png?w=16&h=16&level=0&r=%g", maxSliceR+0.5), http.StatusBadRequest},
+		{"/api/scan/slice.svg?w=16&h=16&level=0&r=5&axis=x", http.StatusOK},
+		{"/api/scan/slice.svg?w=16&h=16&level=0&r=5&axis=w", http.StatusBadRequest},
+		{"/api/scan/slice.png?w=16&h=16&level=6&r=5", http.StatusBadRequest},
+		{"/api/scan/slice.png?w=16&h=16&r=5", http.StatusBadRequest},
+	} {
+		w := do(h, "GET", tc.target, "Bearer "+token, "")
+		if w.Code != tc.wantStatus {
+			t.Errorf("%s: want status %d: got %d: %s", tc.target, tc.wantStatus, w.Code, w.Body.String())
+		}
+	}
+}
@@ -24,32 +24,58 @@
 
 package server
 
-import "net/http"
+import (
+	"github.com/mdhender/lutymaps/pkg/stores/mem"
+	"io/fs"
+	"net/http"
+	"sync"
+)
 
 // Server implements the application's web server.
 type Server struct {
 	authn  Authentication
 	authz  Authorization
+	tokens Tokens
 	app    *App
 	api    *Api
-	public string
+	public fs.FS // static files
 	router http.Handler
 	static http.Handler
+
+	storeLock sync.RWMutex
+	store     *mem.Store
+
+	scanWorkers int // number of scans that may be rendered at the same time
 }
 
 // New returns a partially initialized server.
 // You must still run server.Routes() to create the routes.
+// Unless other options are given, the server's store is used to authenticate and authorize accounts.
 func New(options ...Option) (*Server, error) {
 	s := &Server{
-		app:    &App{},
-		api:    &Api{},
-		public: "D:\\luty\\lutymaps\\public",
+		app:   &App{},
+		store: mem.New(),
+
+		scanWorkers: 2,
 	}
 	for _, opt := range options {
 		if err := opt(s); err != nil {
 			return nil, err
 		}
 	}
+	if s.authn == nil {
+		s.authn = currentStore{s: s}
+	}
+	if s.authz == nil {
+		s.authz = currentStore{s: s}
+	}
+	s.api = &Api{
+		authn:  s.authn,
+		authz:  s.authz,
+		tokens: s.tokens,
+		scans:  make(chan struct{}, s.scanWorkers),
+		store:  s.Store,
+	}
 	return s, nil
 }
 
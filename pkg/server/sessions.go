@@ -0,0 +1,115 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// tokenView is the JSON representation of an issued token.
+type tokenView struct {
+	Token   string    `json:"token"`
+	Expires time.Time `json:"expires"`
+}
+
+// postLogin authenticates the user id and secret in the request body
+// and returns a bearer token for the account.
+func (a *Api) postLogin() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.authn == nil || a.tokens == nil {
+			notImplemented(w, r)
+			return
+		}
+		var input struct {
+			UserId string `json:"user-id"`
+			Secret string `json:"secret"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&input); err != nil {
+			writeError(w, http.StatusBadRequest, "body: want user-id and secret")
+			return
+		}
+		id, ok := a.authn.Authenticate(input.UserId, input.Secret)
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "")
+			return
+		}
+		token, expires, err := a.tokens.Issue(id)
+		if err != nil {
+			log.Printf("api: login: %v\n", err)
+			writeError(w, http.StatusInternalServerError, "")
+			return
+		}
+		writeJSON(w, http.StatusOK, tokenView{Token: token, Expires: expires})
+	}
+}
+
+// postLogout revokes the bearer token used to authenticate the request.
+func (a *Api) postLogout() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := bearerToken(r)
+		if !ok || a.tokens == nil {
+			unauthorized(w)
+			return
+		}
+		if _, ok = a.tokens.AuthenticateToken(token); !ok {
+			unauthorized(w)
+			return
+		}
+		a.tokens.Revoke(token)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// postRefresh revokes the bearer token used to authenticate the request
+// and returns a new token for the same account.
+func (a *Api) postRefresh() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := bearerToken(r)
+		if !ok || a.tokens == nil {
+			unauthorized(w)
+			return
+		}
+		token, expires, err := a.tokens.Refresh(token)
+		if err != nil {
+			unauthorized(w)
+			return
+		}
+		writeJSON(w, http.StatusOK, tokenView{Token: token, Expires: expires})
+	}
+}
+
+// bearerToken returns the bearer token from the Authorization header.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
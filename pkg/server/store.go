@@ -0,0 +1,58 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package server
+
+import "github.com/mdhender/lutymaps/pkg/stores/mem"
+
+// Store returns the server's current store.
+func (s *Server) Store() *mem.Store {
+	s.storeLock.RLock()
+	defer s.storeLock.RUnlock()
+	return s.store
+}
+
+// SwapStore replaces the server's store.
+// Requests that started before the swap keep using the old store.
+func (s *Server) SwapStore(store *mem.Store) {
+	s.storeLock.Lock()
+	defer s.storeLock.Unlock()
+	s.store = store
+}
+
+// currentStore implements the Authentication and Authorization interfaces
+// using whichever store the server has when the request arrives.
+type currentStore struct {
+	s *Server
+}
+
+// Authenticate implements the Authentication interface.
+func (c currentStore) Authenticate(id, secret string) (string, bool) {
+	return c.s.Store().Authenticate(id, secret)
+}
+
+// Authorize implements the Authorization interface.
+func (c currentStore) Authorize(id string) func(role string) bool {
+	return c.s.Store().Authorize(id)
+}
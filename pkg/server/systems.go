@@ -0,0 +1,307 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/mdhender/lutymaps/pkg/stores/mem"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+const (
+	defaultPerPage = 100
+	maxPerPage     = 1000
+)
+
+// systemView is the JSON representation of a system.
+type systemView struct {
+	Id      int    `json:"id"`
+	Name    string `json:"name,omitempty"`
+	X       int    `json:"x"`
+	Y       int    `json:"y"`
+	Z       int    `json:"z"`
+	Kind    string `json:"kind"`
+	Planets int    `json:"planets"` // number of planets in the system
+}
+
+// planetView is the JSON representation of a planet.
+type planetView struct {
+	Orbit        int    `json:"orbit"`
+	Kind         string `json:"kind"`
+	Habitability int    `json:"habitability"`
+	Resources    struct {
+		Metals    int `json:"metals"`
+		NonMetals int `json:"non-metals"`
+		Fuel      int `json:"fuel"`
+	} `json:"resources"`
+}
+
+// newSystemView returns the view of a system from the store, which names the system's kind.
+func newSystemView(store *mem.Store, system *mem.System) systemView {
+	return systemView{
+		Id:      system.Id,
+		Name:    system.Name,
+		X:       system.X,
+		Y:       system.Y,
+		Z:       system.Z,
+		Kind:    store.SystemKindName(system.Kind),
+		Planets: len(system.Planets),
+	}
+}
+
+// systemsPage is the JSON representation of one page of systems.
+type systemsPage struct {
+	Page    int          `json:"page"`
+	PerPage int          `json:"per-page"`
+	Total   int          `json:"total"`
+	Systems []systemView `json:"systems"`
+}
+
+// listSystems returns all systems, optionally filtered by kind.
+func (a *Api) listSystems() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		store := a.store()
+		a.writeSystems(w, r, store, store.Snapshot())
+	}
+}
+
+// getSystem returns the system with the id in the path.
+func (a *Api) getSystem() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "id: not an integer")
+			return
+		}
+		store := a.store()
+		system, ok := store.GetSystem(id)
+		if !ok {
+			writeError(w, http.StatusNotFound, "no system with id")
+			return
+		}
+		writeJSON(w, http.StatusOK, newSystemView(store, &system))
+	}
+}
+
+// getPlanets returns the planets in the system with the id in the path.
+func (a *Api) getPlanets() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "id: not an integer")
+			return
+		}
+		planets, ok := a.store().Planets(id)
+		if !ok {
+			writeError(w, http.StatusNotFound, "no system with id")
+			return
+		}
+		response := struct {
+			SystemId int          `json:"system-id"`
+			Planets  []planetView `json:"planets"`
+		}{
+			SystemId: id,
+			Planets:  []planetView{},
+		}
+		for _, planet := range planets {
+			view := planetView{
+				Orbit:        planet.Orbit,
+				Kind:         planet.Kind.String(),
+				Habitability: planet.Habitability,
+			}
+			view.Resources.Metals = planet.Resources.Metals
+			view.Resources.NonMetals = planet.Resources.NonMetals
+			view.Resources.Fuel = planet.Resources.Fuel
+			response.Planets = append(response.Planets, view)
+		}
+		writeJSON(w, http.StatusOK, response)
+	}
+}
+
+// getSystemsAt returns the systems at the coordinates in the path.
+func (a *Api) getSystemsAt() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var xyz [3]int
+		for i, key := range []string{"x", "y", "z"} {
+			n, err := strconv.Atoi(chi.URLParam(r, key))
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("%s: not an integer", key))
+				return
+			}
+			xyz[i] = n
+		}
+		store := a.store()
+		systems := store.GetSystems(xyz[0], xyz[1], xyz[2])
+		if len(systems) == 0 {
+			writeError(w, http.StatusNotFound, "no systems at coordinates")
+			return
+		}
+		a.writeSystems(w, r, store, systems)
+	}
+}
+
+// getSectorSphere returns the systems within radius r of the point x, y, z.
+func (a *Api) getSectorSphere() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		xyz, err := queryInts(q, "x", "y", "z")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		radius, err := strconv.ParseFloat(q.Get("r"), 64)
+		if err != nil || !(radius >= 0) {
+			writeError(w, http.StatusBadRequest, "r: not a non-negative number")
+			return
+		}
+		store := a.store()
+		a.writeSystems(w, r, store, store.WithinRadius(xyz[0], xyz[1], xyz[2], radius))
+	}
+}
+
+// getSectorBox returns the systems inside the box with corners x1, y1, z1 and x2, y2, z2.
+func (a *Api) getSectorBox() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c, err := queryInts(r.URL.Query(), "x1", "y1", "z1", "x2", "y2", "z2")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		store := a.store()
+		a.writeSystems(w, r, store, store.InBox(c[0], c[1], c[2], c[3], c[4], c[5]))
+	}
+}
+
+// writeSystems filters the systems by the kind in the query, sorts them by
+// coordinates and writes the page requested in the query.
+// The systems must come from the store, which names their kinds.
+func (a *Api) writeSystems(w http.ResponseWriter, r *http.Request, store *mem.Store, systems mem.Systems) {
+	q := r.URL.Query()
+
+	if name := q.Get("kind"); name != "" {
+		kind, ok := store.ParseSystemKind(name)
+		if !ok {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("kind: unknown kind %q", name))
+			return
+		}
+		var filtered mem.Systems
+		for _, system := range systems {
+			if system != nil && system.Kind == kind {
+				filtered = append(filtered, system)
+			}
+		}
+		systems = filtered
+	}
+
+	page, perPage := 1, defaultPerPage
+	if s := q.Get("page"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "page: not a positive integer")
+			return
+		}
+		page = n
+	}
+	if s := q.Get("per-page"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxPerPage {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("per-page: not an integer from 1 to %d", maxPerPage))
+			return
+		}
+		perPage = n
+	}
+
+	sorted := make(mem.Systems, 0, len(systems))
+	for _, system := range systems {
+		if system != nil {
+			sorted = append(sorted, system)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		lhs, rhs := sorted[i], sorted[j]
+		if lhs.X != rhs.X {
+			return lhs.X < rhs.X
+		} else if lhs.Y != rhs.Y {
+			return lhs.Y < rhs.Y
+		} else if lhs.Z != rhs.Z {
+			return lhs.Z < rhs.Z
+		} else if lhs.Kind != rhs.Kind {
+			return lhs.Kind < rhs.Kind
+		}
+		return lhs.Id < rhs.Id
+	})
+
+	response := systemsPage{
+		Page:    page,
+		PerPage: perPage,
+		Total:   len(sorted),
+		Systems: []systemView{},
+	}
+	// pages past the end are empty; checking before multiplying keeps large pages from overflowing
+	if page-1 <= len(sorted)/perPage {
+		for i := (page - 1) * perPage; i < len(sorted) && i < page*perPage; i++ {
+			response.Systems = append(response.Systems, newSystemView(store, sorted[i]))
+		}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// queryInts returns the integer values of the keys in the query.
+func queryInts(q url.Values, keys ...string) ([]int, error) {
+	values := make([]int, len(keys))
+	for i, key := range keys {
+		n, err := strconv.Atoi(q.Get(key))
+		if err != nil {
+			return nil, fmt.Errorf("%s: not an integer", key)
+		}
+		values[i] = n
+	}
+	return values, nil
+}
+
+// writeJSON writes the value as the JSON response.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes a JSON error response.
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, struct {
+		Status  string `json:"status"`
+		Code    string `json:"code"`
+		Message string `json:"message,omitempty"`
+	}{
+		Status:  fmt.Sprintf("%d", status),
+		Code:    http.StatusText(status),
+		Message: message,
+	})
+}
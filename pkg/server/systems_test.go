@@ -0,0 +1,202 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"github.com/mdhender/lutymaps/pkg/stores/mem"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// newTestGalaxy returns a store with the test accounts and a system at every point
+// from -2 to 2 on each axis, with ids from 1 to 125 in order of x, y and z.
+// Every fifth system is a blue super giant and the rest are empty.
+// A dense dust cloud with id 200 shares the origin with system 63.
+func newTestGalaxy(t *testing.T) *mem.Store {
+	t.Helper()
+	store := newTestStore(t)
+	var systems []mem.System
+	for x := -2; x <= 2; x++ {
+		for y := -2; y <= 2; y++ {
+			for z := -2; z <= 2; z++ {
+				system := mem.System{Id: len(systems) + 1, X: x, Y: y, Z: z, Kind: mem.SKEmpty}
+				if system.Id%5 == 0 {
+					system.Kind = mem.SKBlueSuperGiant
+				}
+				systems = append(systems, system)
+			}
+		}
+	}
+	systems = append(systems, mem.System{Id: 200, Kind: mem.SKDenseDustCloud})
+	if err := store.AddSystems(systems...); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestSystems(t *testing.T) {
+	h, tstore := newTestServer(t, newTestGalaxy(t))
+	token, _, err := tstore.Issue("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blue, dense := url.QueryEscape("Blue Super Giant"), url.QueryEscape("Dense Dust Cloud")
+
+	for _, tc := range []struct {
+		target      string
+		wantStatus  int
+		wantTotal   int
+		wantPage    int // number of systems on the page
+		wantFirstId int // id of the first system on the page, if any
+	}{
+		// pages
+		{"/api/systems", http.StatusOK, 126, defaultPerPage, 1},
+		{"/api/systems?page=1", http.StatusOK, 126, defaultPerPage, 1},
+		{"/api/systems?page=2", http.StatusOK, 126, 26, 100},
+		{"/api/systems?page=3", http.StatusOK, 126, 0, 0},
+		{"/api/systems?page=9223372036854775807", http.StatusOK, 126, 0, 0},
+		{"/api/systems?per-page=1", http.StatusOK, 126, 1, 1},
+		{"/api/systems?per-page=1&page=126", http.StatusOK, 126, 1, 125},
+		{"/api/systems?per-page=1&page=127", http.StatusOK, 126, 0, 0},
+		{"/api/systems?per-page=126", http.StatusOK, 126, 126, 1},
+		{"/api/systems?per-page=126&page=2", http.StatusOK, 126, 0, 0},
+		{"/api/systems?per-page=125&page=2", http.StatusOK, 126, 1, 125},
+		{"/api/systems?per-page=1000", http.StatusOK, 126, 126, 1},
+		{"/api/systems?per-page=1000&page=2", http.StatusOK, 126, 0, 0},
+		{"/api/systems?page=0", http.StatusBadRequest, 0, 0, 0},
+		{"/api/systems?page=-1", http.StatusBadRequest, 0, 0, 0},
+		{"/api/systems?page=one", http.StatusBadRequest, 0, 0, 0},
+		{"/api/systems?page=9223372036854775808", http.StatusBadRequest, 0, 0, 0},
+		{"/api/systems?per-page=0", http.StatusBadRequest, 0, 0, 0},
+		{"/api/systems?per-page=1001", http.StatusBadRequest, 0, 0, 0},
+		{"/api/systems?per-page=ten", http.StatusBadRequest, 0, 0, 0},
+
+		// kinds
+		{"/api/systems?kind=" + blue, http.StatusOK, 25, 25, 5},
+		{"/api/systems?kind=" + dense, http.StatusOK, 1, 1, 200},
+		{"/api/systems?kind=Empty&per-page=1000", http.StatusOK, 100, 100, 1},
+		{"/api/systems?kind=" + blue + "&per-page=10&page=3", http.StatusOK, 25, 5, 105},
+		{"/api/systems?kind=Neutron+Star", http.StatusBadRequest, 0, 0, 0},
+		{"/api/systems?kind=blue+super+giant", http.StatusBadRequest, 0, 0, 0},
+
+		// coordinates, sorted by kind and then id
+		{"/api/systems/0/0/0", http.StatusOK, 2, 2, 63},
+		{"/api/systems/-2/-2/-2", http.StatusOK, 1, 1, 1},
+		{"/api/systems/0/0/0?kind=" + dense, http.StatusOK, 1, 1, 200},
+		{"/api/systems/3/0/0", http.StatusNotFound, 0, 0, 0},
+		{"/api/systems/0/zero/0", http.StatusBadRequest, 0, 0, 0},
+		{"/api/systems/0/0/0?page=0", http.StatusBadRequest, 0, 0, 0},
+
+		// spheres
+		{"/api/sectors/sphere?x=0&y=0&z=0&r=0", http.StatusOK, 2, 2, 63},
+		{"/api/sectors/sphere?x=0&y=0&z=0&r=1", http.StatusOK, 8, 8, 38},
+		{"/api/sectors/sphere?x=2&y=2&z=2&r=1.5", http.StatusOK, 7, 7, 95},
+		{"/api/sectors/sphere?x=0&y=0&z=0&r=100", http.StatusOK, 126, defaultPerPage, 1},
+		{"/api/sectors/sphere?x=0&y=0&z=0&r=1&kind=" + dense, http.StatusOK, 1, 1, 200},
+		{"/api/sectors/sphere?x=10&y=0&z=0&r=1", http.StatusOK, 0, 0, 0},
+		{"/api/sectors/sphere?x=0&y=0&z=0&r=-1", http.StatusBadRequest, 0, 0, 0},
+		{"/api/sectors/sphere?x=0&y=0&z=0&r=NaN", http.StatusBadRequest, 0, 0, 0},
+		{"/api/sectors/sphere?x=0&y=0&z=0&r=far", http.StatusBadRequest, 0, 0, 0},
+		{"/api/sectors/sphere?x=0&y=0&z=0", http.StatusBadRequest, 0, 0, 0},
+		{"/api/sectors/sphere?x=0&y=0&r=1", http.StatusBadRequest, 0, 0, 0},
+		{"/api/sectors/sphere?x=0.5&y=0&z=0&r=1", http.StatusBadRequest, 0, 0, 0},
+
+		// boxes, including the faces
+		{"/api/sectors/box?x1=-1&y1=-1&z1=-1&x2=1&y2=1&z2=1", http.StatusOK, 28, 28, 32},
+		{"/api/sectors/box?x1=1&y1=1&z1=1&x2=-1&y2=-1&z2=-1", http.StatusOK, 28, 28, 32},
+		{"/api/sectors/box?x1=2&y1=2&z1=2&x2=2&y2=2&z2=2", http.StatusOK, 1, 1, 125},
+		{"/api/sectors/box?x1=-9&y1=-9&z1=-9&x2=9&y2=9&z2=9&per-page=1000", http.StatusOK, 126, 126, 1},
+		{"/api/sectors/box?x1=-9&y1=-9&z1=-9&x2=9&y2=9&z2=9&kind=" + blue, http.StatusOK, 25, 25, 5},
+		{"/api/sectors/box?x1=3&y1=3&z1=3&x2=9&y2=9&z2=9", http.StatusOK, 0, 0, 0},
+		{"/api/sectors/box?x1=-1&y1=-1&z1=-1&x2=1&y2=1", http.StatusBadRequest, 0, 0, 0},
+		{"/api/sectors/box?x1=-1&y1=-1&z1=-1&x2=1&y2=1&z2=top", http.StatusBadRequest, 0, 0, 0},
+		{"/api/sectors/box?x1=-1&y1=-1&z1=-1&x2=1&y2=1&z2=1&kind=Quasar", http.StatusBadRequest, 0, 0, 0},
+	} {
+		w := do(h, "GET", tc.target, "Bearer "+token, "")
+		if w.Code != tc.wantStatus {
+			t.Errorf("%s: want status %d: got %d: %s", tc.target, tc.wantStatus, w.Code, w.Body.String())
+			continue
+		} else if w.Code != http.StatusOK {
+			continue
+		}
+		var page systemsPage
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+			t.Errorf("%s: %v", tc.target, err)
+			continue
+		}
+		if page.Total != tc.wantTotal {
+			t.Errorf("%s: total: want %d: got %d", tc.target, tc.wantTotal, page.Total)
+		}
+		if len(page.Systems) != tc.wantPage {
+			t.Errorf("%s: page: want %d systems: got %d", tc.target, tc.wantPage, len(page.Systems))
+		} else if len(page.Systems) != 0 && page.Systems[0].Id != tc.wantFirstId {
+			t.Errorf("%s: first: want id %d: got %d", tc.target, tc.wantFirstId, page.Systems[0].Id)
+		}
+		// pages are sorted by coordinates
+		for i := 1; i < len(page.Systems); i++ {
+			lhs, rhs := page.Systems[i-1], page.Systems[i]
+			if [3]int{lhs.X, lhs.Y, lhs.Z} != [3]int{rhs.X, rhs.Y, rhs.Z} && !(lhs.X < rhs.X || lhs.X == rhs.X && (lhs.Y < rhs.Y || lhs.Y == rhs.Y && lhs.Z < rhs.Z)) {
+				t.Errorf("%s: systems %d and %d are out of order", tc.target, lhs.Id, rhs.Id)
+			}
+		}
+	}
+}
+
+func TestSystem(t *testing.T) {
+	h, tstore := newTestServer(t, newTestGalaxy(t))
+	token, _, err := tstore.Issue("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		target     string
+		wantStatus int
+	}{
+		{"/api/systems/1", http.StatusOK},
+		{"/api/systems/200", http.StatusOK},
+		{"/api/systems/0", http.StatusNotFound},
+		{"/api/systems/126", http.StatusNotFound},
+		{"/api/systems/one", http.StatusBadRequest},
+		{"/api/systems/1/planets", http.StatusOK},
+		{"/api/systems/126/planets", http.StatusNotFound},
+		{"/api/systems/one/planets", http.StatusBadRequest},
+	} {
+		if w := do(h, "GET", tc.target, "Bearer "+token, ""); w.Code != tc.wantStatus {
+			t.Errorf("%s: want status %d: got %d: %s", tc.target, tc.wantStatus, w.Code, w.Body.String())
+		}
+	}
+
+	w := do(h, "GET", "/api/systems/200", "Bearer "+token, "")
+	var view systemView
+	if err = json.Unmarshal(w.Body.Bytes(), &view); err != nil {
+		t.Fatal(err)
+	}
+	want := systemView{Id: 200, Kind: "Dense Dust Cloud"}
+	if view != want {
+		t.Errorf("system 200: want %+v: got %+v", want, view)
+	}
+}
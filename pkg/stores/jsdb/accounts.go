@@ -58,12 +58,14 @@ func (s *AccountStore) Load(path string) error {
 }
 
 // Save writes the store to the path.
+// The file is readable only by its owner since it contains secrets.
+// See writeFile for how the file is replaced.
 func (s *AccountStore) Save(path string) error {
 	buf, err := json.MarshalIndent(s, "", "  ")
 	if err != nil {
 		return fmt.Errorf("jsdb: %w", err)
 	}
-	err = os.WriteFile(path, buf, 0666)
+	err = writeFile(path, buf, 0600)
 	if err != nil {
 		return fmt.Errorf("jsdb: %w", err)
 	}
@@ -0,0 +1,138 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package jsdb
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+const (
+	backups = 5 // number of numbered backups kept for each file
+)
+
+// writeFile replaces the file at path with buf.
+// The data is written to a temporary file in the same directory, synced to disk
+// and then renamed over the old file, so a crash leaves either the old file or
+// the new one, never a partial file.
+// The old file is kept as path.1, the previous path.1 becomes path.2, and so on.
+// The file is locked while it is replaced; see Lock.
+func writeFile(path string, buf []byte, perm os.FileMode) error {
+	unlock, err := lockForSave(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer func() {
+		// no-op after a successful rename
+		_ = os.Remove(tmpName)
+	}()
+	if _, err = tmp.Write(buf); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Chmod(perm); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	if err = rotateBackups(path, perm); err != nil {
+		return err
+	}
+	if err = os.Rename(tmpName, path); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(path))
+	return nil
+}
+
+// rotateBackups shifts the numbered backups of path up by one and copies path to path.1.
+// The oldest backup is removed.
+func rotateBackups(path string, perm os.FileMode) error {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err := os.Remove(backupName(path, backups)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for n := backups - 1; n > 0; n-- {
+		if err := os.Rename(backupName(path, n), backupName(path, n+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return copyFile(path, backupName(path, 1), perm)
+}
+
+// backupName returns the name of the n'th backup of path.
+func backupName(path string, n int) string {
+	return path + "." + strconv.Itoa(n)
+}
+
+// copyFile copies the file at src to dst.
+func copyFile(src, dst string, perm os.FileMode) error {
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(w, r); err != nil {
+		_ = w.Close()
+		return err
+	}
+	if err = w.Sync(); err != nil {
+		_ = w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// syncDir flushes the directory entry for a renamed file to disk.
+// Not every platform supports this, so errors are ignored.
+func syncDir(dir string) {
+	if fd, err := os.Open(dir); err == nil {
+		_ = fd.Sync()
+		_ = fd.Close()
+	}
+}
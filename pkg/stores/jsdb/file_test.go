@@ -0,0 +1,225 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package jsdb
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestMain holds the lock on the file named by LUTYMAPS_TEST_LOCK when the test binary
+// is started by TestLockBetweenProcesses. It holds the lock until its input is closed.
+func TestMain(m *testing.M) {
+	if path := os.Getenv("LUTYMAPS_TEST_LOCK"); path != "" {
+		unlock, err := Lock(path)
+		if err != nil {
+			os.Stdout.WriteString(err.Error() + "\n")
+			os.Exit(1)
+		}
+		os.Stdout.WriteString("locked\n")
+		_, _ = io.Copy(io.Discard, os.Stdin)
+		unlock()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// names returns the names of the files in the directory, sorted.
+func names(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list []string
+	for _, e := range entries {
+		list = append(list, e.Name())
+	}
+	sort.Strings(list)
+	return list
+}
+
+func TestWriteFileReplaces(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "galaxy.json")
+	if err := writeFile(path, []byte("one"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = writeFile(path, []byte("two"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	after, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the new data is written to another file and renamed over the old one,
+	// so the old file is never partly overwritten
+	if os.SameFile(before, after) {
+		t.Errorf("file was written in place")
+	}
+	if buf, _ := os.ReadFile(path); string(buf) != "two" {
+		t.Errorf("file: want %q: got %q", "two", buf)
+	}
+	if buf, _ := os.ReadFile(path + ".1"); string(buf) != "one" {
+		t.Errorf("backup: want %q: got %q", "one", buf)
+	}
+	want := []string{"galaxy.json", "galaxy.json.1", "galaxy.json.lock"}
+	if got := names(t, dir); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("files: want %v: got %v", want, got)
+	}
+}
+
+func TestBackupsRotate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "galaxy.json")
+	for n := 1; n <= backups+3; n++ {
+		if err := writeFile(path, []byte(strconv.Itoa(n)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the file holds the last save and the backups hold the saves before it, newest first
+	last := backups + 3
+	if buf, _ := os.ReadFile(path); string(buf) != strconv.Itoa(last) {
+		t.Errorf("file: want %d: got %q", last, buf)
+	}
+	for n := 1; n <= backups; n++ {
+		if buf, _ := os.ReadFile(backupName(path, n)); string(buf) != strconv.Itoa(last-n) {
+			t.Errorf("backup %d: want %d: got %q", n, last-n, buf)
+		}
+	}
+	if _, err := os.Stat(backupName(path, backups+1)); !os.IsNotExist(err) {
+		t.Errorf("backup %d: want it removed: got %v", backups+1, err)
+	}
+	if got := len(names(t, dir)); got != backups+2 {
+		t.Errorf("files: want the file, %d backups and the lock: got %v", backups, names(t, dir))
+	}
+}
+
+func TestAccountsMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not supported on windows")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "accounts.json")
+	s := &AccountStore{Accounts: []*Account{{Id: "1", UserId: "u", Secret: "s", Roles: []string{"user"}}}}
+	for i := 0; i < 2; i++ {
+		if err := s.Save(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{path, path + ".1"} {
+		sb, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode := sb.Mode().Perm(); mode != 0600 {
+			t.Errorf("%s: want mode 0600: got %04o", filepath.Base(name), mode)
+		}
+	}
+	var loaded AccountStore
+	if err := loaded.Load(path); err != nil {
+		t.Fatal(err)
+	} else if len(loaded.Accounts) != 1 || loaded.Accounts[0].Secret != "s" {
+		t.Errorf("load: want the saved account: got %+v", loaded.Accounts)
+	}
+}
+
+func TestLockInProcess(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "galaxy.json")
+	unlock, err := Lock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Lock(path); err == nil {
+		t.Errorf("second lock: want error: got nil")
+	}
+	// saves made while holding the lock use it
+	if err = writeFile(path, []byte("one"), 0644); err != nil {
+		t.Errorf("save while locked: %v", err)
+	}
+	unlock()
+	unlock, err = Lock(path)
+	if err != nil {
+		t.Fatalf("lock after unlock: %v", err)
+	}
+	unlock()
+}
+
+func TestLockBetweenProcesses(t *testing.T) {
+	if runtime.GOOS != "windows" && runtime.GOOS != "linux" && runtime.GOOS != "darwin" && runtime.GOOS != "freebsd" {
+		t.Skip("no file locks on " + runtime.GOOS)
+	}
+	path := filepath.Join(t.TempDir(), "galaxy.json")
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), "LUTYMAPS_TEST_LOCK="+path)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = stdin.Close()
+		_ = cmd.Wait()
+	}()
+	if line, _ := bufio.NewReader(stdout).ReadString('\n'); line != "locked\n" {
+		t.Fatalf("other process: want %q: got %q", "locked\n", line)
+	}
+
+	if _, err = Lock(path); err == nil {
+		t.Errorf("lock held by another process: want error: got nil")
+	}
+	if err = writeFile(path, []byte("one"), 0644); err == nil {
+		t.Errorf("save while another process holds the lock: want error: got nil")
+	}
+
+	// the lock is released when the other process exits
+	_ = stdin.Close()
+	if err = cmd.Wait(); err != nil {
+		t.Fatalf("other process: %v", err)
+	}
+	unlock, err := Lock(path)
+	if err != nil {
+		t.Fatalf("lock after the other process exited: %v", err)
+	}
+	unlock()
+}
@@ -31,11 +31,17 @@ import (
 )
 
 // New loads the store from the given path.
+// Files from older versions are upgraded in memory; use Migrate to upgrade the file itself.
+// Files from newer versions are rejected.
 func New(path string) (*Store, error) {
 	buf, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("jsdb: %w", err)
 	}
+	buf, _, err = upgrade(buf)
+	if err != nil {
+		return nil, fmt.Errorf("jsdb: %s: %w", path, err)
+	}
 	var s Store
 	err = json.Unmarshal(buf, &s)
 	if err != nil {
@@ -45,12 +51,13 @@ func New(path string) (*Store, error) {
 }
 
 // Save writes the store to the given path.
+// See writeFile for how the file is replaced.
 func (s *Store) Save(path string) error {
 	buf, err := json.MarshalIndent(s, "", "  ")
 	if err != nil {
 		return fmt.Errorf("jsdb: %w", err)
 	}
-	err = os.WriteFile(path, buf, 0666)
+	err = writeFile(path, buf, 0644)
 	if err != nil {
 		return fmt.Errorf("jsdb: %w", err)
 	}
@@ -38,8 +38,26 @@ type Meta struct {
 
 // System implements the data for a system.
 type System struct { // TODO: Should be immutable.
-	X    int    `json:"x"`
-	Y    int    `json:"y"`
-	Z    int    `json:"z"`
-	Kind string `json:"kind"`
+	Id      int       `json:"id"`
+	Name    string    `json:"name,omitempty"`
+	X       int       `json:"x"`
+	Y       int       `json:"y"`
+	Z       int       `json:"z"`
+	Kind    string    `json:"kind"`
+	Planets []*Planet `json:"planets,omitempty"`
+}
+
+// Planet implements the data for a planet in a system.
+type Planet struct {
+	Orbit        int       `json:"orbit"`
+	Kind         string    `json:"kind"`
+	Habitability int       `json:"habitability"`
+	Resources    Resources `json:"resources"`
+}
+
+// Resources implements the data for the deposits on a planet.
+type Resources struct {
+	Metals    int `json:"metals"`
+	NonMetals int `json:"non-metals"`
+	Fuel      int `json:"fuel"`
 }
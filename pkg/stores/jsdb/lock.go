@@ -0,0 +1,90 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package jsdb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// errLocked is returned by the platform lock when another process holds it.
+var errLocked = errors.New("locked by another process")
+
+// held is the set of files locked by this process.
+// The operating system lock belongs to an open file, so a second lock taken
+// by this process would fail; saves made while holding Lock use the held lock.
+var held = struct {
+	sync.Mutex
+	paths map[string]bool
+}{paths: make(map[string]bool)}
+
+// Lock takes the lock on the file at path and returns a function that releases it.
+// Commands that load a file, change it and save it should hold the lock from
+// before the load until after the save, so that no other process saves the file in between.
+// Saves made by this process while it holds the lock don't wait for it.
+//
+// The lock is an operating system lock on path.lock, so it is released
+// if the process exits without unlocking, and the lock file is left in place.
+// It fails if another process holds the lock.
+func Lock(path string) (unlock func(), err error) {
+	held.Lock()
+	defer held.Unlock()
+	if held.paths[path] {
+		return nil, fmt.Errorf("jsdb: %s: already locked", path)
+	}
+	fd, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("jsdb: %w", err)
+	}
+	if err = lockFD(fd); err != nil {
+		_ = fd.Close()
+		return nil, fmt.Errorf("jsdb: %s: %w", path, err)
+	}
+	// the pid is only for people looking for the process that holds the lock
+	if err = fd.Truncate(0); err == nil {
+		_, _ = fmt.Fprintf(fd, "%d\n", os.Getpid())
+	}
+	held.paths[path] = true
+	return func() {
+		held.Lock()
+		defer held.Unlock()
+		delete(held.paths, path)
+		_ = unlockFD(fd)
+		_ = fd.Close()
+	}, nil
+}
+
+// lockForSave takes the lock for a save unless this process already holds it.
+func lockForSave(path string) (unlock func(), err error) {
+	held.Lock()
+	locked := held.paths[path]
+	held.Unlock()
+	if locked {
+		return func() {}, nil
+	}
+	return Lock(path)
+}
@@ -0,0 +1,170 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package jsdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// CurrentVersion is the version of the file format that this package reads and writes.
+const CurrentVersion = 3
+
+// migration upgrades a document by one version.
+// The document is the top level JSON object of the file.
+// The caller updates the version in the meta data after the migration succeeds.
+type migration func(doc map[string]json.RawMessage) error
+
+// migrations holds the upgrade from each version to the next,
+// so migrations[n] upgrades a document from version n to version n+1.
+// There must be exactly one migration for every version before CurrentVersion.
+var migrations = []migration{
+	0: func(doc map[string]json.RawMessage) error {
+		// files written before the version was tracked have the same layout as version 1
+		return nil
+	},
+	1: func(doc map[string]json.RawMessage) error {
+		// version 2 added ids to systems. some files were given ids by hand,
+		// so keep those and number the rest after the highest id, in the order they appear.
+		raw, ok := doc["systems"]
+		if !ok {
+			return nil
+		}
+		var systems []map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &systems); err != nil {
+			return fmt.Errorf("systems: %w", err)
+		}
+		highest := 0
+		for i, system := range systems {
+			// the loaders skip null systems, so leave them for the loaders
+			if raw, ok := system["id"]; ok && system != nil {
+				var id int
+				if err := json.Unmarshal(raw, &id); err != nil {
+					return fmt.Errorf("system #%d: id: %w", i+1, err)
+				} else if id > highest {
+					highest = id
+				}
+			}
+		}
+		for _, system := range systems {
+			if _, ok := system["id"]; ok || system == nil {
+				continue
+			}
+			highest++
+			id, err := json.Marshal(highest)
+			if err != nil {
+				return err
+			}
+			system["id"] = id
+		}
+		raw, err := json.Marshal(systems)
+		if err != nil {
+			return err
+		}
+		doc["systems"] = raw
+		return nil
+	},
+	2: func(doc map[string]json.RawMessage) error {
+		// version 3 added planets to systems; systems without planets have the same layout
+		return nil
+	},
+}
+
+func init() {
+	if len(migrations) != CurrentVersion {
+		panic(fmt.Sprintf("jsdb: have %d migrations for version %d", len(migrations), CurrentVersion))
+	}
+}
+
+// upgrade returns the document in buf converted to the current version,
+// along with the version that the document started at.
+// It returns an error if the document is from a newer version.
+func upgrade(buf []byte) ([]byte, int, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(buf, &doc); err != nil {
+		return nil, 0, err
+	}
+	var meta Meta
+	if raw, ok := doc["meta"]; ok {
+		if err := json.Unmarshal(raw, &meta); err != nil {
+			return nil, 0, fmt.Errorf("meta: %w", err)
+		}
+	}
+	from := meta.Version
+	if from < 0 {
+		return nil, from, fmt.Errorf("version %d is not valid", from)
+	} else if from > CurrentVersion {
+		return nil, from, fmt.Errorf("version %d is newer than this program supports (%d)", from, CurrentVersion)
+	} else if from == CurrentVersion {
+		return buf, from, nil
+	}
+
+	for version := from; version < CurrentVersion; version++ {
+		if err := migrations[version](doc); err != nil {
+			return nil, from, fmt.Errorf("upgrade from version %d: %w", version, err)
+		}
+		raw, err := json.Marshal(Meta{Version: version + 1})
+		if err != nil {
+			return nil, from, err
+		}
+		doc["meta"] = raw
+	}
+
+	buf, err := json.Marshal(doc)
+	if err != nil {
+		return nil, from, err
+	}
+	return buf, from, nil
+}
+
+// Migrate upgrades the file at path to the current version.
+// The old file is kept as a numbered backup.
+// It returns the version the file started at.
+// The file is locked from before it is read until after it is saved.
+func Migrate(path string) (int, error) {
+	unlock, err := Lock(path)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("jsdb: %w", err)
+	}
+	buf, from, err := upgrade(buf)
+	if err != nil {
+		return from, fmt.Errorf("jsdb: %s: %w", path, err)
+	}
+	if from == CurrentVersion {
+		return from, nil
+	}
+	var s Store
+	if err = json.Unmarshal(buf, &s); err != nil {
+		return from, fmt.Errorf("jsdb: %s: %w", path, err)
+	}
+	return from, s.Save(path)
+}
@@ -0,0 +1,139 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package jsdb
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUpgrade(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		file    string
+		wantIds []int
+	}{
+		{"version 0", `{"systems":[{"x":1,"y":2,"z":3,"kind":"Empty"},{"x":4,"y":5,"z":6,"kind":"Empty"}]}`, []int{1, 2}},
+		{"version 1", `{"meta":{"version":1},"systems":[{"x":1,"y":2,"z":3,"kind":"Empty"},null,{"x":4,"y":5,"z":6,"kind":"Empty"}]}`, []int{1, 2}},
+		{"some ids", `{"meta":{"version":1},"systems":[{"x":1,"y":2,"z":3,"kind":"Empty"},{"id":7,"x":4,"y":5,"z":6,"kind":"Empty"},{"x":7,"y":8,"z":9,"kind":"Empty"},{"id":3,"x":0,"y":0,"z":0,"kind":"Empty"}]}`, []int{8, 7, 9, 3}},
+		{"all ids", `{"meta":{"version":1},"systems":[{"id":5,"x":1,"y":2,"z":3,"kind":"Empty"},{"id":2,"x":4,"y":5,"z":6,"kind":"Empty"}]}`, []int{5, 2}},
+		{"version 2", `{"meta":{"version":2},"systems":[{"id":4,"x":1,"y":2,"z":3,"kind":"Empty"}]}`, []int{4}},
+		{"current", `{"meta":{"version":3},"systems":[{"id":4,"x":1,"y":2,"z":3,"kind":"Empty"}]}`, []int{4}},
+	} {
+		path := filepath.Join(t.TempDir(), "galaxy.json")
+		if err := os.WriteFile(path, []byte(tc.file), 0644); err != nil {
+			t.Fatal(err)
+		}
+		s, err := New(path)
+		if err != nil {
+			t.Errorf("%s: load: %v", tc.name, err)
+			continue
+		}
+		if s.Meta.Version != CurrentVersion {
+			t.Errorf("%s: version: want %d: got %d", tc.name, CurrentVersion, s.Meta.Version)
+		}
+		var ids []int
+		for _, system := range s.Systems {
+			if system != nil {
+				ids = append(ids, system.Id)
+			}
+		}
+		if len(ids) != len(tc.wantIds) {
+			t.Errorf("%s: ids: want %v: got %v", tc.name, tc.wantIds, ids)
+			continue
+		}
+		for i := range ids {
+			if ids[i] != tc.wantIds[i] {
+				t.Errorf("%s: ids: want %v: got %v", tc.name, tc.wantIds, ids)
+				break
+			}
+		}
+	}
+}
+
+func TestUpgradeRejects(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		file    string
+		wantErr string
+	}{
+		{"newer", `{"meta":{"version":4},"systems":[]}`, "version 4 is newer than this program supports (3)"},
+		{"negative", `{"meta":{"version":-1},"systems":[]}`, "version -1 is not valid"},
+		{"bad id", `{"meta":{"version":1},"systems":[{"id":"one","x":0,"y":0,"z":0,"kind":"Empty"}]}`, "system #1: id"},
+	} {
+		path := filepath.Join(t.TempDir(), "galaxy.json")
+		if err := os.WriteFile(path, []byte(tc.file), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := New(path); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("%s: load: want %q: got %v", tc.name, tc.wantErr, err)
+		}
+		if _, err := Migrate(path); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("%s: migrate: want %q: got %v", tc.name, tc.wantErr, err)
+		}
+		// a file that can't be upgraded is left alone
+		if buf, _ := os.ReadFile(path); string(buf) != tc.file {
+			t.Errorf("%s: file was changed: %q", tc.name, buf)
+		}
+		if _, err := os.Stat(path + ".1"); !os.IsNotExist(err) {
+			t.Errorf("%s: backup: want none: got %v", tc.name, err)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "galaxy.json")
+	old := `{"meta":{"version":1},"systems":[{"x":1,"y":2,"z":3,"kind":"Empty"}]}`
+	if err := os.WriteFile(path, []byte(old), 0644); err != nil {
+		t.Fatal(err)
+	}
+	from, err := Migrate(path)
+	if err != nil {
+		t.Fatal(err)
+	} else if from != 1 {
+		t.Errorf("from: want 1: got %d", from)
+	}
+	if buf, _ := os.ReadFile(path + ".1"); string(buf) != old {
+		t.Errorf("backup: want the old file: got %q", buf)
+	}
+	s, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(s.Systems) != 1 || s.Systems[0].Id != 1 {
+		t.Errorf("systems: want one with id 1: got %+v", s.Systems)
+	}
+
+	// a file at the current version is not written again
+	if from, err = Migrate(path); err != nil {
+		t.Fatal(err)
+	} else if from != CurrentVersion {
+		t.Errorf("from: want %d: got %d", CurrentVersion, from)
+	}
+	if _, err = os.Stat(path + ".2"); !os.IsNotExist(err) {
+		t.Errorf("second backup: want none: got %v", err)
+	}
+}
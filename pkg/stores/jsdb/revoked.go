@@ -0,0 +1,66 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package jsdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// RevokedStore implements a flat file data store for revoked bearer tokens.
+type RevokedStore struct {
+	Tokens map[string]time.Time `json:"tokens"` // token id to expiration time
+}
+
+// Load loads the store from the path.
+func (s *RevokedStore) Load(path string) error {
+	s.Tokens = nil
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("jsdb: %w", err)
+	}
+	err = json.Unmarshal(buf, &s)
+	if err != nil {
+		return fmt.Errorf("jsdb: %w", err)
+	}
+	return nil
+}
+
+// Save writes the store to the path.
+// The file is readable only by its owner like the accounts file.
+// See writeFile for how the file is replaced.
+func (s *RevokedStore) Save(path string) error {
+	buf, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("jsdb: %w", err)
+	}
+	err = writeFile(path, buf, 0600)
+	if err != nil {
+		return fmt.Errorf("jsdb: %w", err)
+	}
+	return nil
+}
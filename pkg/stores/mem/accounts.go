@@ -24,6 +24,13 @@
 
 package mem
 
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"sync"
+)
+
 type Accounts map[string]Account
 
 // Account details
@@ -35,21 +42,164 @@ type Account struct {
 }
 
 // Authenticate implements the server.Authentication interface.
+// The id is the account's user id.
+// If the secret matches the account's hashed secret, it returns the account id.
 func (s *Store) Authenticate(id, secret string) (string, bool) {
-	if id == "whiskey" && secret == "tango.foxtrot" {
-		return "00112233-4455-6677-8899-aabbccddeeff", true
+	s.mu.RLock()
+	var acct Account
+	var found bool
+	for _, a := range s.accounts {
+		if a.UserId == id {
+			acct, found = a, true
+			break
+		}
+	}
+	s.mu.RUnlock()
+	if !found {
+		// compare against a dummy hash so that unknown users take as long as known ones
+		_ = bcrypt.CompareHashAndPassword(dummyHash(), []byte(secret))
+		return "", false
 	}
-	return "", false
+	if bcrypt.CompareHashAndPassword([]byte(acct.HashedSecret), []byte(secret)) != nil {
+		return "", false
+	}
+	return acct.Id, true
 }
 
 // Authorize implements the server.Authorization interface.
+// The id is the account id returned by Authenticate.
 func (s *Store) Authorize(id string) func(role string) bool {
-	if id == "00112233-4455-6677-8899-aabbccddeeff" {
-		return func(role string) bool {
-			return role == "guest"
+	acct, ok := s.GetAccount(id)
+	if !ok {
+		return func(_ string) bool {
+			return false
+		}
+	}
+	return func(role string) bool {
+		return acct.Roles[role]
+	}
+}
+
+// AddAccount adds a copy of the account to the store.
+// It returns an error if the id or user id is already in use.
+func (s *Store) AddAccount(acct Account) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if acct.Id == "" {
+		return errors.New("account id must not be empty")
+	}
+	for _, a := range s.accounts {
+		if a.Id == acct.Id {
+			return fmt.Errorf("account %q: duplicate id", acct.Id)
+		} else if a.UserId == acct.UserId {
+			return fmt.Errorf("account %q: duplicate user id %q", acct.Id, acct.UserId)
 		}
 	}
-	return func(_ string) bool {
+	if s.accounts == nil {
+		s.accounts = make(Accounts)
+	}
+	s.accounts[acct.Id] = acct.copy()
+	return nil
+}
+
+// GetAccount returns a copy of the account with the id.
+func (s *Store) GetAccount(id string) (Account, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	acct, ok := s.accounts[id]
+	if !ok {
+		return Account{}, false
+	}
+	return acct.copy(), true
+}
+
+// UpdateAccount replaces the account that has the same id.
+// It returns an error if there is no such account or if the user id is used by another account.
+func (s *Store) UpdateAccount(acct Account) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.accounts[acct.Id]; !ok {
+		return fmt.Errorf("account %q: not found", acct.Id)
+	}
+	for _, a := range s.accounts {
+		if a.Id != acct.Id && a.UserId == acct.UserId {
+			return fmt.Errorf("account %q: duplicate user id %q", acct.Id, acct.UserId)
+		}
+	}
+	s.accounts[acct.Id] = acct.copy()
+	return nil
+}
+
+// DeleteAccount removes the account with the id.
+// It returns false if there is no such account.
+func (s *Store) DeleteAccount(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.accounts[id]; !ok {
 		return false
 	}
+	delete(s.accounts, id)
+	return true
+}
+
+// SetAccounts replaces all the accounts in the store with copies of the given accounts.
+func (s *Store) SetAccounts(accts Accounts) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accounts = make(Accounts, len(accts))
+	for id, acct := range accts {
+		s.accounts[id] = acct.copy()
+	}
+}
+
+// AccountsSnapshot returns copies of all the accounts in the store.
+func (s *Store) AccountsSnapshot() Accounts {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	accts := make(Accounts, len(s.accounts))
+	for id, acct := range s.accounts {
+		accts[id] = acct.copy()
+	}
+	return accts
+}
+
+// copy returns a copy of the account that doesn't share the roles map.
+func (a Account) copy() Account {
+	roles := make(map[string]bool, len(a.Roles))
+	for role, ok := range a.Roles {
+		roles[role] = ok
+	}
+	a.Roles = roles
+	return a
+}
+
+// HashSecret returns the hash to store for the secret.
+func HashSecret(secret string) (string, error) {
+	if secret == "" {
+		return "", errors.New("secret must not be empty")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// IsHashedSecret returns true if the secret looks like a hash from HashSecret.
+func IsHashedSecret(secret string) bool {
+	_, err := bcrypt.Cost([]byte(secret))
+	return err == nil
+}
+
+var dummy struct {
+	once sync.Once
+	hash []byte
+}
+
+// dummyHash returns a hash that no secret is expected to match.
+func dummyHash() []byte {
+	dummy.once.Do(func() {
+		dummy.hash, _ = bcrypt.GenerateFromPassword([]byte("dummy secret for unknown users"), bcrypt.DefaultCost)
+	})
+	return dummy.hash
 }
@@ -0,0 +1,257 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package mem
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// index is a static k-d tree over the systems in a store.
+// The tree is stored implicitly in the slice: for any range of the slice,
+// the middle element is the node, the elements before it are the left
+// subtree and the elements after it are the right subtree.
+// The split axis cycles through X, Y and Z as the tree gets deeper.
+type index struct {
+	systems Systems
+}
+
+// newIndex returns an index over the systems, ignoring nil entries.
+func newIndex(systems Systems) *index {
+	idx := &index{}
+	for _, system := range systems {
+		if system != nil {
+			idx.systems = append(idx.systems, system)
+		}
+	}
+	idx.build(0, len(idx.systems), 0)
+	return idx
+}
+
+// build arranges the range so that the middle element splits the range on the axis.
+func (idx *index) build(lo, hi, axis int) {
+	if hi-lo < 2 {
+		return
+	}
+	sub := idx.systems[lo:hi]
+	sort.Slice(sub, func(i, j int) bool {
+		return coordinate(sub[i], axis) < coordinate(sub[j], axis)
+	})
+	mid, next := (lo+hi)/2, (axis+1)%3
+	idx.build(lo, mid, next)
+	idx.build(mid+1, hi, next)
+}
+
+// inBox appends the systems in the range that are inside the box.
+func (idx *index) inBox(lo, hi, axis int, min, max [3]int, found Systems) Systems {
+	if lo >= hi {
+		return found
+	}
+	mid, next := (lo+hi)/2, (axis+1)%3
+	system := idx.systems[mid]
+	if min[0] <= system.X && system.X <= max[0] &&
+		min[1] <= system.Y && system.Y <= max[1] &&
+		min[2] <= system.Z && system.Z <= max[2] {
+		found = append(found, system)
+	}
+	c := coordinate(system, axis)
+	if min[axis] <= c {
+		found = idx.inBox(lo, mid, next, min, max, found)
+	}
+	if c <= max[axis] {
+		found = idx.inBox(mid+1, hi, next, min, max, found)
+	}
+	return found
+}
+
+// withinRadius appends the systems in the range that are within the radius of the point.
+func (idx *index) withinRadius(lo, hi, axis int, point [3]int, radius float64, found Systems) Systems {
+	if lo >= hi {
+		return found
+	}
+	mid, next := (lo+hi)/2, (axis+1)%3
+	system := idx.systems[mid]
+	if float64(distanceSquared(system, point)) <= radius*radius {
+		found = append(found, system)
+	}
+	delta := float64(point[axis] - coordinate(system, axis))
+	if delta <= radius {
+		found = idx.withinRadius(lo, mid, next, point, radius, found)
+	}
+	if -delta <= radius {
+		found = idx.withinRadius(mid+1, hi, next, point, radius, found)
+	}
+	return found
+}
+
+// nearest pushes the systems in the range that are closer than the
+// furthest candidate onto the heap, keeping at most k candidates.
+// A subtree at the same distance as the furthest candidate is still searched
+// because it may hold a system with a lower id.
+func (idx *index) nearest(lo, hi, axis int, point [3]int, k int, h *candidates) {
+	if lo >= hi {
+		return
+	}
+	mid, next := (lo+hi)/2, (axis+1)%3
+	system := idx.systems[mid]
+	h.offer(candidate{system: system, distance: distanceSquared(system, point)}, k)
+	delta := point[axis] - coordinate(system, axis)
+	if delta < 0 { // point is on the left side of the split
+		idx.nearest(lo, mid, next, point, k, h)
+		if h.Len() < k || delta*delta <= (*h)[0].distance {
+			idx.nearest(mid+1, hi, next, point, k, h)
+		}
+	} else {
+		idx.nearest(mid+1, hi, next, point, k, h)
+		if h.Len() < k || delta*delta <= (*h)[0].distance {
+			idx.nearest(lo, mid, next, point, k, h)
+		}
+	}
+}
+
+// candidate is a system and its squared distance from the query point.
+type candidate struct {
+	system   *System
+	distance int
+}
+
+// closer returns true if the candidate is closer than the other,
+// or at the same distance and has a lower id.
+func (c candidate) closer(other candidate) bool {
+	if c.distance != other.distance {
+		return c.distance < other.distance
+	}
+	return c.system.Id < other.system.Id
+}
+
+// candidates is a max-heap of candidates ordered by distance and then id.
+type candidates []candidate
+
+func (h candidates) Len() int            { return len(h) }
+func (h candidates) Less(i, j int) bool  { return h[j].closer(h[i]) }
+func (h candidates) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *candidates) Push(x interface{}) { *h = append(*h, x.(candidate)) }
+func (h *candidates) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// offer adds the candidate if there are fewer than k candidates or if it is
+// closer than the furthest candidate, which it then replaces.
+func (h *candidates) offer(c candidate, k int) {
+	if h.Len() < k {
+		heap.Push(h, c)
+	} else if c.closer((*h)[0]) {
+		(*h)[0] = c
+		heap.Fix(h, 0)
+	}
+}
+
+// coordinate returns the system's coordinate on the axis.
+func coordinate(system *System, axis int) int {
+	switch axis {
+	case 0:
+		return system.X
+	case 1:
+		return system.Y
+	}
+	return system.Z
+}
+
+// distanceSquared returns the square of the distance between the system and the point.
+func distanceSquared(system *System, point [3]int) int {
+	dx, dy, dz := system.X-point[0], system.Y-point[1], system.Z-point[2]
+	return dx*dx + dy*dy + dz*dz
+}
+
+// InBox returns copies of the systems inside the box with the given corners, including the faces of the box.
+// The systems are returned in no particular order.
+func (s *Store) InBox(x1, y1, z1, x2, y2, z2 int) Systems {
+	min := [3]int{minInt(x1, x2), minInt(y1, y2), minInt(z1, z2)}
+	max := [3]int{maxInt(x1, x2), maxInt(y1, y2), maxInt(z1, z2)}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.index == nil {
+		return nil
+	}
+	return copySystems(s.index.inBox(0, len(s.index.systems), 0, min, max, nil))
+}
+
+// WithinRadius returns copies of the systems that are no further than radius from the point.
+// It returns the same systems as Filter(FilterBySector(x, y, z, radius)),
+// in no particular order.
+func (s *Store) WithinRadius(x, y, z int, radius float64) Systems {
+	if radius < 0 {
+		return nil
+	}
+	point := [3]int{x, y, z}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.index == nil {
+		return nil
+	}
+	return copySystems(s.index.withinRadius(0, len(s.index.systems), 0, point, radius, nil))
+}
+
+// Nearest returns copies of the k systems closest to the point, nearest first.
+// Systems at the same distance are ordered by id, so the results don't depend on the shape of the index.
+func (s *Store) Nearest(x, y, z int, k int) Systems {
+	if k < 1 {
+		return nil
+	}
+	point := [3]int{x, y, z}
+	h := &candidates{}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.index == nil {
+		return nil
+	}
+	s.index.nearest(0, len(s.index.systems), 0, point, k, h)
+	sort.Slice(*h, func(i, j int) bool {
+		return (*h)[i].closer((*h)[j])
+	})
+	systems := make(Systems, len(*h))
+	for i, c := range *h {
+		cp := c.system.copy()
+		systems[i] = &cp
+	}
+	return systems
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
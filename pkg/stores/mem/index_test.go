@@ -0,0 +1,136 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package mem
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// testStore returns a store with n systems scattered through a cube of the given size.
+// Small cubes put many systems at the same distance from any point.
+func testStore(tb testing.TB, n, size int) *Store {
+	rnd := rand.New(rand.NewSource(1))
+	systems := make([]System, n)
+	for i := range systems {
+		systems[i] = System{X: rnd.Intn(size), Y: rnd.Intn(size), Z: rnd.Intn(size), Kind: SKYellowMainSequence}
+	}
+	s := New()
+	if err := s.AddSystems(systems...); err != nil {
+		tb.Fatalf("add: %v", err)
+	}
+	return s
+}
+
+// ids returns the ids of the systems, sorted if sorted is true.
+func ids(systems Systems, sorted bool) []int {
+	var list []int
+	for _, system := range systems {
+		list = append(list, system.Id)
+	}
+	if sorted {
+		sort.Ints(list)
+	}
+	return list
+}
+
+func TestWithinRadius(t *testing.T) {
+	s := testStore(t, 2000, 40)
+	for _, r := range []float64{0, 1, 2.5, 7, 100} {
+		want := ids(s.Filter(FilterBySector(20, 20, 20, r)), true)
+		got := ids(s.WithinRadius(20, 20, 20, r), true)
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("radius %g: want %d systems: got %d", r, len(want), len(got))
+		}
+	}
+}
+
+func TestInBox(t *testing.T) {
+	s := testStore(t, 2000, 40)
+	want := ids(s.Filter(func(system *System) bool {
+		return 5 <= system.X && system.X <= 15 && 10 <= system.Y && system.Y <= 30 && 0 <= system.Z && system.Z <= 3
+	}), true)
+	got := ids(s.InBox(15, 30, 3, 5, 10, 0), true)
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("box: want %v: got %v", want, got)
+	}
+}
+
+func TestNearest(t *testing.T) {
+	s := testStore(t, 2000, 12)
+	point := [3]int{6, 6, 6}
+	all := s.Snapshot()
+	sort.Slice(all, func(i, j int) bool {
+		di, dj := distanceSquared(all[i], point), distanceSquared(all[j], point)
+		if di != dj {
+			return di < dj
+		}
+		return all[i].Id < all[j].Id
+	})
+	for _, k := range []int{1, 5, 50, 500} {
+		want := ids(all[:k], false)
+		got := ids(s.Nearest(point[0], point[1], point[2], k), false)
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("k %d: want %v: got %v", k, want, got)
+		}
+	}
+}
+
+// BenchmarkWithinRadius compares the index with a linear scan of the store.
+func BenchmarkWithinRadius(b *testing.B) {
+	s := testStore(b, 100000, 1000)
+	b.Run("index", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			s.WithinRadius(500, 500, 500, 50)
+		}
+	})
+	b.Run("filter", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			s.Filter(FilterBySector(500, 500, 500, 50))
+		}
+	})
+}
+
+// BenchmarkNearest compares the index with sorting the systems found by a linear scan.
+func BenchmarkNearest(b *testing.B) {
+	s := testStore(b, 100000, 1000)
+	point := [3]int{500, 500, 500}
+	b.Run("index", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			s.Nearest(point[0], point[1], point[2], 10)
+		}
+	})
+	b.Run("filter", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			systems := s.Filter(func(*System) bool { return true })
+			sort.Slice(systems, func(i, j int) bool {
+				return distanceSquared(systems[i], point) < distanceSquared(systems[j], point)
+			})
+			_ = systems[:10]
+		}
+	})
+}
@@ -0,0 +1,139 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package mem
+
+import "fmt"
+
+// SystemKind is an enum for the type of system
+type SystemKind int
+
+const (
+	SKEmpty SystemKind = iota
+	SKBlueSuperGiant
+	SKDenseDustCloud
+	SKMediumDustCloud
+	SKYellowMainSequence
+	SKLightDustCloud
+)
+
+// kinds is the registry of system kind names.
+// It is the only place that maps the known kinds to the names used in data files.
+// Kinds that a store keeps from lenient loading are numbered after these; see Store.RegisterSystemKind.
+var kinds = struct {
+	names  []string
+	byName map[string]SystemKind
+}{
+	names: []string{
+		SKEmpty:              "Empty",
+		SKBlueSuperGiant:     "Blue Super Giant",
+		SKDenseDustCloud:     "Dense Dust Cloud",
+		SKMediumDustCloud:    "Medium Dust Cloud",
+		SKYellowMainSequence: "Yellow Main Sequence",
+		SKLightDustCloud:     "Light Dust Cloud",
+	},
+}
+
+func init() {
+	kinds.byName = make(map[string]SystemKind)
+	for sk, name := range kinds.names {
+		kinds.byName[name] = SystemKind(sk)
+	}
+}
+
+// String implements the Stringer interface.
+// It returns an empty string for kinds that are not known,
+// including kinds registered with a store.
+func (sk SystemKind) String() string {
+	if sk < 0 || int(sk) >= len(kinds.names) {
+		return ""
+	}
+	return kinds.names[sk]
+}
+
+// ParseSystemKind returns the known kind with the name.
+func ParseSystemKind(name string) (SystemKind, bool) {
+	sk, ok := kinds.byName[name]
+	return sk, ok
+}
+
+// SystemKinds returns all the known kinds in order.
+func SystemKinds() []SystemKind {
+	list := make([]SystemKind, len(kinds.names))
+	for i := range list {
+		list[i] = SystemKind(i)
+	}
+	return list
+}
+
+// RegisterSystemKind returns the kind with the name, adding it to the store if it isn't known.
+// It lets callers keep kinds that this package doesn't know about instead of discarding them.
+// Kinds added this way belong to the store and are dropped with it,
+// so use the store's SystemKindName and ParseSystemKind to convert them.
+// It returns an error if the name is empty.
+func (s *Store) RegisterSystemKind(name string) (SystemKind, error) {
+	if name == "" {
+		return SKEmpty, fmt.Errorf("system kind must not be empty")
+	} else if sk, ok := ParseSystemKind(name); ok {
+		return sk, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, kind := range s.kinds {
+		if kind == name {
+			return SystemKind(len(kinds.names) + i), nil
+		}
+	}
+	s.kinds = append(s.kinds, name)
+	return SystemKind(len(kinds.names) + len(s.kinds) - 1), nil
+}
+
+// SystemKindName returns the name of the kind, which may be known or registered with the store.
+// It returns an empty string for any other kind.
+func (s *Store) SystemKindName(sk SystemKind) string {
+	if name := sk.String(); name != "" {
+		return name
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if i := int(sk) - len(kinds.names); i >= 0 && i < len(s.kinds) {
+		return s.kinds[i]
+	}
+	return ""
+}
+
+// ParseSystemKind returns the kind with the name, which may be known or registered with the store.
+func (s *Store) ParseSystemKind(name string) (SystemKind, bool) {
+	if sk, ok := ParseSystemKind(name); ok {
+		return sk, true
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for i, kind := range s.kinds {
+		if kind == name {
+			return SystemKind(len(kinds.names) + i), true
+		}
+	}
+	return SKEmpty, false
+}
@@ -0,0 +1,66 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package mem
+
+import "testing"
+
+func TestRegisterSystemKind(t *testing.T) {
+	s1, s2 := New(), New()
+	if sk, err := s1.RegisterSystemKind("Yellow Main Sequence"); err != nil || sk != SKYellowMainSequence {
+		t.Errorf("known kind: want %d: got %d, %v", SKYellowMainSequence, sk, err)
+	}
+	if _, err := s1.RegisterSystemKind(""); err == nil {
+		t.Errorf("empty kind: want error: got nil")
+	}
+
+	pulsar, err := s1.RegisterSystemKind("Pulsar")
+	if err != nil {
+		t.Fatalf("pulsar: %v", err)
+	}
+	if again, _ := s1.RegisterSystemKind("Pulsar"); again != pulsar {
+		t.Errorf("pulsar again: want %d: got %d", pulsar, again)
+	}
+	if name := s1.SystemKindName(pulsar); name != "Pulsar" {
+		t.Errorf("pulsar name: want %q: got %q", "Pulsar", name)
+	}
+	if sk, ok := s1.ParseSystemKind("Pulsar"); !ok || sk != pulsar {
+		t.Errorf("parse pulsar: want %d: got %d, %v", pulsar, sk, ok)
+	}
+
+	// kinds registered with one store are not known to other stores or to the package
+	if _, ok := ParseSystemKind("Pulsar"); ok {
+		t.Errorf("package: pulsar is known")
+	} else if name := pulsar.String(); name != "" {
+		t.Errorf("package: pulsar is named %q", name)
+	}
+	if _, ok := s2.ParseSystemKind("Pulsar"); ok {
+		t.Errorf("other store: pulsar is known")
+	} else if name := s2.SystemKindName(pulsar); name != "" {
+		t.Errorf("other store: pulsar is named %q", name)
+	}
+	if n := len(SystemKinds()); n != int(SKLightDustCloud)+1 {
+		t.Errorf("package: want %d kinds: got %d", SKLightDustCloud+1, n)
+	}
+}
@@ -23,10 +23,25 @@
  */
 
 // Package mem implements an in-memory data store.
+//
+// The store owns its data and is safe for concurrent use.
+// Methods that read systems or accounts return copies,
+// so callers may keep or change the results without affecting the store.
 package mem
 
+import "sync"
+
 // Store implements an in-memory data store.
 type Store struct {
-	Accounts map[string]Account
-	Systems  Systems
+	mu       sync.RWMutex
+	accounts Accounts
+	systems  Systems
+	byId     map[int]*System // systems by id
+	index    *index          // spatial index over systems
+	kinds    []string        // names of the kinds registered with the store
+}
+
+// New returns an empty store.
+func New() *Store {
+	return &Store{accounts: make(Accounts), byId: make(map[int]*System)}
 }
@@ -0,0 +1,118 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package mem
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestConcurrentAccess runs readers and writers against one store at the same time.
+// It is meant to be run with the race detector: go test -race ./pkg/stores/mem
+func TestConcurrentAccess(t *testing.T) {
+	s := New()
+	var seed []System
+	for i := 0; i < 200; i++ {
+		seed = append(seed, System{X: i%10 - 5, Y: i/10%10 - 5, Z: i/100 - 1, Kind: SKYellowMainSequence})
+	}
+	if err := s.AddSystems(seed...); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	const rounds = 200
+	var wg sync.WaitGroup
+	errc := make(chan error, 8)
+
+	// writers add, update and delete their own systems
+	for w := 0; w < 2; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				id := 10000*(w+1) + i
+				if err := s.AddSystems(System{Id: id, X: i % 7, Y: w, Z: -i % 5, Kind: SKBlueSuperGiant}); err != nil {
+					errc <- err
+					return
+				}
+				if err := s.UpdateSystem(System{Id: id, X: -i % 7, Y: w, Z: i % 5, Kind: SKEmpty, Planets: []Planet{{Orbit: 1, Kind: PKRocky}}}); err != nil {
+					errc <- err
+					return
+				}
+				if i%2 == 0 && !s.DeleteSystem(id) {
+					t.Errorf("delete %d: not found", id)
+					return
+				}
+			}
+		}(w)
+	}
+
+	// readers query the store and change what they get back
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				for _, sys := range s.InBox(-3, -3, -1, 3, 3, 1) {
+					sys.X++
+				}
+				for _, sys := range s.WithinRadius(0, 0, 0, 4) {
+					sys.Planets = append(sys.Planets, Planet{Orbit: 9})
+				}
+				if found := s.Nearest(0, 0, 0, 5); len(found) != 5 {
+					t.Errorf("nearest: want 5 systems: got %d", len(found))
+					return
+				}
+				if n := len(s.Snapshot()); n < len(seed) {
+					t.Errorf("snapshot: want at least %d systems: got %d", len(seed), n)
+					return
+				}
+				if sys, ok := s.GetSystem(1); ok {
+					sys.Name = "changed"
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errc)
+	for err := range errc {
+		t.Error(err)
+	}
+
+	// half of each writer's systems were deleted and the readers' changes were made to copies
+	if got, want := s.SystemCount(), len(seed)+rounds; got != want {
+		t.Errorf("count: want %d: got %d", want, got)
+	}
+	if sys, _ := s.GetSystem(1); sys.Name != "" {
+		t.Errorf("system 1: reader changed the store's copy: name %q", sys.Name)
+	}
+	for _, sys := range s.Snapshot() {
+		for _, p := range sys.Planets {
+			if p.Orbit == 9 {
+				t.Fatalf("system %d: reader changed the store's planets", sys.Id)
+			}
+		}
+	}
+}
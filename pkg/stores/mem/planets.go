@@ -0,0 +1,144 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package mem
+
+import (
+	"fmt"
+	"sort"
+)
+
+// PlanetKind is an enum for the type of planet
+type PlanetKind int
+
+const (
+	PKUnknown PlanetKind = iota
+	PKAsteroidBelt
+	PKGasGiant
+	PKIceGiant
+	PKRocky
+	PKTerrestrial
+	PKOcean
+)
+
+// planetKinds maps planet kinds to the names used in data files.
+var planetKinds = []string{
+	PKUnknown:      "Unknown",
+	PKAsteroidBelt: "Asteroid Belt",
+	PKGasGiant:     "Gas Giant",
+	PKIceGiant:     "Ice Giant",
+	PKRocky:        "Rocky",
+	PKTerrestrial:  "Terrestrial",
+	PKOcean:        "Ocean",
+}
+
+// String implements the Stringer interface.
+func (pk PlanetKind) String() string {
+	if pk < 0 || int(pk) >= len(planetKinds) {
+		return ""
+	}
+	return planetKinds[pk]
+}
+
+// ParsePlanetKind returns the kind with the name.
+func ParsePlanetKind(name string) (PlanetKind, bool) {
+	for pk, s := range planetKinds {
+		if s == name {
+			return PlanetKind(pk), true
+		}
+	}
+	return PKUnknown, false
+}
+
+// MaxHabitability is the habitability of a planet that is ideal for colonists.
+const MaxHabitability = 25
+
+// Planet implements the data for a planet in a system.
+type Planet struct {
+	Orbit        int // orbit number, starting at 1 for the innermost orbit
+	Kind         PlanetKind
+	Habitability int // 0 is uninhabitable, MaxHabitability is ideal
+	Resources    Resources
+}
+
+// Resources are the deposits on a planet.
+type Resources struct {
+	Metals    int
+	NonMetals int
+	Fuel      int
+}
+
+// validatePlanets returns an error if any planet has an invalid or duplicate orbit
+// or habitability or resources out of range.
+func validatePlanets(planets []Planet) error {
+	orbits := make(map[int]bool)
+	for _, planet := range planets {
+		if planet.Orbit < 1 {
+			return fmt.Errorf("planet: invalid orbit %d", planet.Orbit)
+		} else if orbits[planet.Orbit] {
+			return fmt.Errorf("planet: duplicate orbit %d", planet.Orbit)
+		} else if planet.Habitability < 0 || planet.Habitability > MaxHabitability {
+			return fmt.Errorf("orbit %d: invalid habitability %d", planet.Orbit, planet.Habitability)
+		} else if planet.Resources.Metals < 0 || planet.Resources.NonMetals < 0 || planet.Resources.Fuel < 0 {
+			return fmt.Errorf("orbit %d: invalid resources", planet.Orbit)
+		}
+		orbits[planet.Orbit] = true
+	}
+	return nil
+}
+
+// Planets returns copies of the planets in the system with the id, in orbit order.
+// It returns false if there is no such system.
+func (s *Store) Planets(id int) ([]Planet, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	system, ok := s.byId[id]
+	if !ok {
+		return nil, false
+	}
+	return system.copy().Planets, true
+}
+
+// PlanetCount returns the number of planets in all the systems.
+func PlanetCount(systems Systems) int {
+	n := 0
+	for _, system := range systems {
+		if system != nil {
+			n += len(system.Planets)
+		}
+	}
+	return n
+}
+
+// copy returns a copy of the system that doesn't share planets with the original.
+// The planets are sorted by orbit.
+func (s System) copy() System {
+	cp := s
+	if s.Planets != nil {
+		cp.Planets = make([]Planet, len(s.Planets))
+		copy(cp.Planets, s.Planets)
+		sort.Slice(cp.Planets, func(i, j int) bool { return cp.Planets[i].Orbit < cp.Planets[j].Orbit })
+	}
+	return cp
+}
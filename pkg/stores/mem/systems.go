@@ -24,12 +24,17 @@
 
 package mem
 
+import "fmt"
+
 type Systems []*System
 
 // System implements the data for a system.
 type System struct {
+	Id      int    // unique, stable identifier
+	Name    string // optional display name
 	X, Y, Z int
 	Kind    SystemKind
+	Planets []Planet
 }
 
 func (s *System) Points() (float64, float64, float64) {
@@ -39,41 +44,161 @@ func (s *System) Points() (float64, float64, float64) {
 	return float64(s.X), float64(s.Y), float64(s.Z)
 }
 
-// SystemKind is an enum for the type of system
-type SystemKind int
-
-const (
-	SKEmpty SystemKind = iota
-	SKBlueSuperGiant
-	SKDenseDustCloud
-	SKMediumDustCloud
-	SKYellowMainSequence
-)
-
-// String implements the Stringer interface.
-func (sk SystemKind) String() string {
-	switch sk {
-	case SKEmpty:
-		return "Empty"
-	case SKBlueSuperGiant:
-		return "Blue Super Giant"
-	case SKDenseDustCloud:
-		return "Dense Dust Cloud"
-	case SKMediumDustCloud:
-		return "Medium Dust Cloud"
-	case SKYellowMainSequence:
-		return "Yellow Main Sequence"
-	}
-	return ""
-}
-
+// Filter returns copies of the systems that fn accepts.
+// The function is given a copy of each system.
 func (s *Store) Filter(fn func(*System) bool) Systems {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	var systems Systems
-	for _, system := range s.Systems {
-		if !fn(system) {
+	for _, system := range s.systems {
+		cp := system.copy()
+		if !fn(&cp) {
 			continue
 		}
-		systems = append(systems, system)
+		systems = append(systems, &cp)
 	}
 	return systems
 }
+
+// Snapshot returns copies of all the systems in the store.
+// Long running readers, like scans, should work from a snapshot
+// rather than holding on to the store.
+func (s *Store) Snapshot() Systems {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return copySystems(s.systems)
+}
+
+// SystemCount returns the number of systems in the store.
+func (s *Store) SystemCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.systems)
+}
+
+// AddSystems adds copies of the systems to the store.
+// Systems with an id of zero are given the next free id.
+// It returns an error, and adds none of the systems, if any id is negative or already in use
+// or if any system has invalid planets.
+// Like every change to the systems, it rebuilds the whole spatial index,
+// so add systems in batches rather than one at a time.
+func (s *Store) AddSystems(systems ...System) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.byId == nil {
+		s.byId = make(map[int]*System)
+	}
+	added := make(map[int]bool)
+	for i, system := range systems {
+		if system.Id < 0 {
+			return fmt.Errorf("system %d: invalid id %d", i, system.Id)
+		} else if _, ok := s.byId[system.Id]; ok || added[system.Id] {
+			return fmt.Errorf("system %d: duplicate id %d", i, system.Id)
+		} else if err := validatePlanets(system.Planets); err != nil {
+			return fmt.Errorf("system %d: %w", i, err)
+		} else if system.Id != 0 {
+			added[system.Id] = true
+		}
+	}
+	next := s.nextId(added)
+	for _, system := range systems {
+		cp := system.copy()
+		if cp.Id == 0 {
+			cp.Id, next = next, next+1
+		}
+		s.systems = append(s.systems, &cp)
+		s.byId[cp.Id] = &cp
+	}
+	s.reindex()
+	return nil
+}
+
+// GetSystem returns a copy of the system with the id.
+func (s *Store) GetSystem(id int) (System, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	system, ok := s.byId[id]
+	if !ok {
+		return System{}, false
+	}
+	return system.copy(), true
+}
+
+// GetSystems returns copies of the systems at the coordinates.
+func (s *Store) GetSystems(x, y, z int) Systems {
+	return s.InBox(x, y, z, x, y, z)
+}
+
+// UpdateSystem replaces the system that has the same id.
+// It returns an error if there is no such system.
+// It rebuilds the whole spatial index.
+func (s *Store) UpdateSystem(system System) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sys, ok := s.byId[system.Id]
+	if !ok {
+		return fmt.Errorf("system %d: not found", system.Id)
+	} else if err := validatePlanets(system.Planets); err != nil {
+		return fmt.Errorf("system %d: %w", system.Id, err)
+	}
+	*sys = system.copy()
+	s.reindex()
+	return nil
+}
+
+// DeleteSystem removes the system with the id.
+// It returns false if there is no such system.
+// It rebuilds the whole spatial index.
+func (s *Store) DeleteSystem(id int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.byId[id]; !ok {
+		return false
+	}
+	delete(s.byId, id)
+	for i, sys := range s.systems {
+		if sys.Id == id {
+			s.systems = append(s.systems[:i], s.systems[i+1:]...)
+			break
+		}
+	}
+	s.reindex()
+	return true
+}
+
+// nextId returns an id greater than any in the store or in the reserved set.
+// The caller must hold the write lock.
+func (s *Store) nextId(reserved map[int]bool) int {
+	id := 0
+	for n := range s.byId {
+		if n > id {
+			id = n
+		}
+	}
+	for n := range reserved {
+		if n > id {
+			id = n
+		}
+	}
+	return id + 1
+}
+
+// reindex rebuilds the spatial index from scratch.
+// The index is static, so every change to the systems costs O(n log n);
+// that is fine for a store that is loaded once and rarely changed.
+// The caller must hold the write lock.
+func (s *Store) reindex() {
+	s.index = newIndex(s.systems)
+}
+
+// copySystems returns copies of the systems, skipping nil entries.
+func copySystems(systems Systems) Systems {
+	list := make(Systems, 0, len(systems))
+	for _, system := range systems {
+		if system != nil {
+			cp := system.copy()
+			list = append(list, &cp)
+		}
+	}
+	return list
+}
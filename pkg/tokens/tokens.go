@@ -0,0 +1,221 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+// Package tokens implements signed, expiring bearer tokens.
+//
+// Tokens are JSON Web Tokens signed with HMAC-SHA256.
+// Revoked tokens are remembered until they expire.
+package tokens
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MinKeyLength is the minimum length of a signing key in bytes.
+const MinKeyLength = 32
+
+// ErrInvalidToken is returned when a token is malformed, badly signed, expired or revoked.
+var ErrInvalidToken = errors.New("invalid token")
+
+// Store issues and verifies tokens.
+type Store struct {
+	key []byte
+	ttl time.Duration
+
+	mu      sync.Mutex
+	revoked map[string]time.Time // token id to expiration time
+}
+
+// header is the JOSE header for every token.
+var header = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// claims is the payload of a token.
+type claims struct {
+	Id        string `json:"jti"`
+	Subject   string `json:"sub"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// New returns a store that signs tokens with the key.
+// Tokens expire after the ttl.
+func New(key []byte, ttl time.Duration) (*Store, error) {
+	if len(key) < MinKeyLength {
+		return nil, fmt.Errorf("tokens: key must be at least %d bytes", MinKeyLength)
+	}
+	if ttl <= 0 {
+		return nil, fmt.Errorf("tokens: ttl must be positive: %v", ttl)
+	}
+	return &Store{
+		key:     append([]byte{}, key...),
+		ttl:     ttl,
+		revoked: make(map[string]time.Time),
+	}, nil
+}
+
+// Issue returns a new token for the id and the time that it expires.
+func (s *Store) Issue(id string) (string, time.Time, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", time.Time{}, fmt.Errorf("tokens: %w", err)
+	}
+	now := time.Now()
+	expires := now.Add(s.ttl).Truncate(time.Second)
+	payload, err := json.Marshal(claims{
+		Id:        hex.EncodeToString(buf),
+		Subject:   id,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expires.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("tokens: %w", err)
+	}
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + s.sign(unsigned), expires, nil
+}
+
+// AuthenticateToken implements the server.TokenAuthentication interface.
+func (s *Store) AuthenticateToken(token string) (string, bool) {
+	c, err := s.verify(token)
+	if err != nil {
+		return "", false
+	}
+	return c.Subject, true
+}
+
+// Refresh revokes the token and returns a new token for the same id.
+// A token can be refreshed only once, even by requests running at the same time.
+func (s *Store) Refresh(token string) (string, time.Time, error) {
+	c, err := s.verify(token)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if !s.revoke(c) {
+		// another request revoked the token after it was verified
+		return "", time.Time{}, ErrInvalidToken
+	}
+	return s.Issue(c.Subject)
+}
+
+// Revoke revokes the token.
+// It does nothing if the token is not valid.
+func (s *Store) Revoke(token string) {
+	if c, err := s.verify(token); err == nil {
+		s.revoke(c)
+	}
+}
+
+// revoke remembers the token id until the token expires.
+// It returns false if the token was already revoked.
+// It also forgets revoked tokens that have expired.
+func (s *Store) revoke(c claims) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.revoked[c.Id]; ok {
+		return false
+	}
+	now := time.Now()
+	for id, expires := range s.revoked {
+		if now.After(expires) {
+			delete(s.revoked, id)
+		}
+	}
+	s.revoked[c.Id] = time.Unix(c.ExpiresAt, 0)
+	return true
+}
+
+// Revoked returns the ids of the revoked tokens that haven't expired,
+// with the time that each expires, so that they can be saved.
+func (s *Store) Revoked() map[string]time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	revoked := make(map[string]time.Time)
+	for id, expires := range s.revoked {
+		if !now.After(expires) {
+			revoked[id] = expires
+		}
+	}
+	return revoked
+}
+
+// Restore revokes the token ids returned by an earlier call to Revoked.
+// Ids that have expired are ignored.
+func (s *Store) Restore(revoked map[string]time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for id, expires := range revoked {
+		if !now.After(expires) {
+			s.revoked[id] = expires
+		}
+	}
+}
+
+// verify checks the signature, expiration and revocation of the token and returns the claims.
+func (s *Store) verify(token string) (claims, error) {
+	var c claims
+	fields := strings.Split(token, ".")
+	if len(fields) != 3 || fields[0] != header {
+		return c, ErrInvalidToken
+	}
+	unsigned := fields[0] + "." + fields[1]
+	if !hmac.Equal([]byte(fields[2]), []byte(s.sign(unsigned))) {
+		return c, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(fields[1])
+	if err != nil {
+		return c, ErrInvalidToken
+	}
+	if err = json.Unmarshal(payload, &c); err != nil || c.Id == "" || c.Subject == "" {
+		return c, ErrInvalidToken
+	}
+	if !time.Now().Before(time.Unix(c.ExpiresAt, 0)) {
+		return c, ErrInvalidToken
+	}
+	s.mu.Lock()
+	_, revoked := s.revoked[c.Id]
+	s.mu.Unlock()
+	if revoked {
+		return c, ErrInvalidToken
+	}
+	return c, nil
+}
+
+// sign returns the encoded signature for the unsigned token.
+func (s *Store) sign(unsigned string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
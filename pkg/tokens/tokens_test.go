@@ -0,0 +1,297 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package tokens
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+// forge returns a token for the claims signed with the store's key.
+func forge(t *testing.T, s *Store, c claims) string {
+	t.Helper()
+	payload, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + s.sign(unsigned)
+}
+
+func TestNew(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		key     []byte
+		ttl     time.Duration
+		wantErr bool
+	}{
+		{"ok", testKey, time.Hour, false},
+		{"short key", testKey[:MinKeyLength-1], time.Hour, true},
+		{"zero ttl", testKey, 0, true},
+		{"negative ttl", testKey, -time.Hour, true},
+	} {
+		if _, err := New(tc.key, tc.ttl); (err != nil) != tc.wantErr {
+			t.Errorf("%s: want error %v: got %v", tc.name, tc.wantErr, err)
+		}
+	}
+}
+
+func TestIssueAndVerify(t *testing.T) {
+	s, err := New(testKey, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := time.Now()
+	token, expires, err := s.Issue("42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expires.Before(before.Add(time.Hour-time.Second)) || expires.After(before.Add(time.Hour+time.Second)) {
+		t.Errorf("expires: want about an hour from now: got %v", expires)
+	}
+	if id, ok := s.AuthenticateToken(token); !ok || id != "42" {
+		t.Errorf("authenticate: want 42 true: got %q %v", id, ok)
+	}
+	// tokens are unique even for the same id
+	if other, _, err := s.Issue("42"); err != nil {
+		t.Fatal(err)
+	} else if other == token {
+		t.Errorf("issue: want a new token: got the same one")
+	}
+	// another key doesn't accept the token
+	other, err := New([]byte(strings.Repeat("x", MinKeyLength)), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := other.AuthenticateToken(token); ok {
+		t.Errorf("other key: want rejected: got accepted")
+	}
+}
+
+func TestRejected(t *testing.T) {
+	s, err := New(testKey, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := s.Issue("42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := strings.Split(token, ".")
+	now := time.Now()
+	// change the subject without signing the token again
+	payload, _ := json.Marshal(claims{Id: "abc", Subject: "1", IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix()})
+	tampered := fields[0] + "." + base64.RawURLEncoding.EncodeToString(payload) + "." + fields[2]
+	// flip the last character of the signature
+	last := "A"
+	if strings.HasSuffix(token, "A") {
+		last = "B"
+	}
+
+	for _, tc := range []struct {
+		name  string
+		token string
+	}{
+		{"empty", ""},
+		{"garbage", "not a token"},
+		{"two fields", fields[0] + "." + fields[1]},
+		{"other header", base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + fields[1] + "." + fields[2]},
+		{"tampered payload", tampered},
+		{"tampered signature", token[:len(token)-1] + last},
+		{"no signature", fields[0] + "." + fields[1] + "."},
+		{"expired", forge(t, s, claims{Id: "abc", Subject: "42", IssuedAt: now.Add(-2 * time.Hour).Unix(), ExpiresAt: now.Add(-time.Second).Unix()})},
+		{"no id", forge(t, s, claims{Subject: "42", IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix()})},
+		{"no subject", forge(t, s, claims{Id: "abc", IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix()})},
+	} {
+		if id, ok := s.AuthenticateToken(tc.token); ok {
+			t.Errorf("%s: want rejected: got %q", tc.name, id)
+		}
+		if _, _, err := s.Refresh(tc.token); err != ErrInvalidToken {
+			t.Errorf("%s: refresh: want %v: got %v", tc.name, ErrInvalidToken, err)
+		}
+	}
+	// the original token is still good
+	if _, ok := s.AuthenticateToken(token); !ok {
+		t.Errorf("token: want accepted: got rejected")
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	s, err := New(testKey, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := s.Issue("42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, err := s.Issue("42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Revoke(token)
+	if _, ok := s.AuthenticateToken(token); ok {
+		t.Errorf("revoked: want rejected: got accepted")
+	}
+	if _, ok := s.AuthenticateToken(other); !ok {
+		t.Errorf("other token: want accepted: got rejected")
+	}
+	// revoking again or revoking garbage does nothing
+	s.Revoke(token)
+	s.Revoke("garbage")
+	if got := len(s.Revoked()); got != 1 {
+		t.Errorf("revoked: want 1: got %d", got)
+	}
+}
+
+func TestRevokedRestore(t *testing.T) {
+	s, err := New(testKey, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := s.Issue("42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Revoke(token)
+	revoked := s.Revoked()
+	revoked["expired"] = time.Now().Add(-time.Second)
+
+	// a new store with the same key, like a server after a restart
+	restarted, err := New(testKey, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := restarted.AuthenticateToken(token); !ok {
+		t.Fatalf("before restore: want accepted: got rejected")
+	}
+	restarted.Restore(revoked)
+	if _, ok := restarted.AuthenticateToken(token); ok {
+		t.Errorf("after restore: want rejected: got accepted")
+	}
+	if got := restarted.Revoked(); len(got) != 1 {
+		t.Errorf("revoked: want only the token that hasn't expired: got %v", got)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	s, err := New(testKey, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := s.Issue("42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshed, _, err := s.Refresh(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshed == token {
+		t.Errorf("refresh: want a new token: got the same one")
+	}
+	if id, ok := s.AuthenticateToken(refreshed); !ok || id != "42" {
+		t.Errorf("refreshed: want 42 true: got %q %v", id, ok)
+	}
+	if _, ok := s.AuthenticateToken(token); ok {
+		t.Errorf("old token: want rejected: got accepted")
+	}
+	if _, _, err = s.Refresh(token); err != ErrInvalidToken {
+		t.Errorf("refresh old token: want %v: got %v", ErrInvalidToken, err)
+	}
+	if _, _, err = s.Refresh(refreshed); err != nil {
+		t.Errorf("refresh new token: %v", err)
+	}
+}
+
+func TestRefreshConcurrent(t *testing.T) {
+	s, err := New(testKey, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for round := 0; round < 50; round++ {
+		token, _, err := s.Issue("42")
+		if err != nil {
+			t.Fatal(err)
+		}
+		const n = 8
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		var refreshed []string
+		start := make(chan struct{})
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				if token, _, err := s.Refresh(token); err == nil {
+					mu.Lock()
+					refreshed = append(refreshed, token)
+					mu.Unlock()
+				} else if err != ErrInvalidToken {
+					t.Errorf("refresh: %v", err)
+				}
+			}()
+		}
+		close(start)
+		wg.Wait()
+		// only one of the requests gets a new token
+		if len(refreshed) != 1 {
+			t.Fatalf("round %d: want 1 refresh: got %d", round, len(refreshed))
+		}
+	}
+}
+
+func TestRefreshAfterVerify(t *testing.T) {
+	s, err := New(testKey, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := s.Issue("42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// two requests verify the token before either revokes it
+	first, err := s.verify(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.verify(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.revoke(first) {
+		t.Errorf("first revoke: want true: got false")
+	}
+	if s.revoke(second) {
+		t.Errorf("second revoke: want false: got true")
+	}
+}
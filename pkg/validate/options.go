@@ -0,0 +1,70 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package validate
+
+import "fmt"
+
+// Option configures a validation pass.
+type Option func(*options) error
+
+// options holds the rules for a validation pass.
+type options struct {
+	bounds        int     // systems must be within -bounds..bounds on each axis; 0 is unbounded
+	minSeparation float64 // minimum distance between systems; 0 allows shared coordinates
+	lenient       bool    // report unknown kinds as warnings
+}
+
+// WithBounds requires systems to be within -size..size on each axis.
+// A size of 0 removes the bounds.
+func WithBounds(size int) Option {
+	return func(o *options) error {
+		if size < 0 {
+			return fmt.Errorf("bounds must not be negative: %d", size)
+		}
+		o.bounds = size
+		return nil
+	}
+}
+
+// WithMinSeparation sets the minimum distance between systems.
+// Any positive distance also makes duplicate coordinates an error.
+func WithMinSeparation(distance float64) Option {
+	return func(o *options) error {
+		if distance < 0 {
+			return fmt.Errorf("min separation must not be negative: %g", distance)
+		}
+		o.minSeparation = distance
+		return nil
+	}
+}
+
+// WithLenient reports unknown kinds as warnings instead of errors,
+// matching the lenient load mode. A missing kind is always an error.
+func WithLenient(lenient bool) Option {
+	return func(o *options) error {
+		o.lenient = lenient
+		return nil
+	}
+}
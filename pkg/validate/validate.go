@@ -0,0 +1,248 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+// Package validate implements checks for galaxy data.
+//
+// The checks run against the file format so that the same pass
+// can be used on loaded, generated and migrated galaxies.
+package validate
+
+import (
+	"fmt"
+	"github.com/mdhender/lutymaps/pkg/stores/jsdb"
+	"github.com/mdhender/lutymaps/pkg/stores/mem"
+	"math"
+)
+
+// Severity is how serious a problem is.
+// Only errors make a galaxy invalid.
+type Severity string
+
+const (
+	Error   Severity = "error"
+	Warning Severity = "warning"
+)
+
+// Codes identify the kind of problem for tools that read reports.
+const (
+	CodeDuplicateCoordinates = "duplicate-coordinates"
+	CodeDuplicateId          = "duplicate-id"
+	CodeLoad                 = "load"
+	CodeMissingId            = "missing-id"
+	CodeOutOfBounds          = "out-of-bounds"
+	CodeTooClose             = "too-close"
+	CodeUnknownKind          = "unknown-kind"
+)
+
+// Problem is one finding from a validation pass.
+// Messages name systems as "system #n (id i)", where n is the position
+// of the system in the file, counting from 1.
+type Problem struct {
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"`
+	Message  string   `json:"message"`
+	Systems  []int    `json:"systems"` // ids of the systems involved
+}
+
+// Report is the result of a validation pass.
+type Report struct {
+	Systems  int       `json:"systems"` // number of systems checked
+	Errors   int       `json:"errors"`
+	Warnings int       `json:"warnings"`
+	Problems []Problem `json:"problems"`
+}
+
+// HasErrors returns true if the report contains any errors.
+func (r *Report) HasErrors() bool {
+	return r.Errors != 0
+}
+
+// Err returns an error describing the first error in the report,
+// or nil if there are no errors.
+func (r *Report) Err() error {
+	for _, p := range r.Problems {
+		if p.Severity == Error {
+			if r.Errors == 1 {
+				return fmt.Errorf("validate: %s", p.Message)
+			}
+			return fmt.Errorf("validate: %s (and %d more errors)", p.Message, r.Errors-1)
+		}
+	}
+	return nil
+}
+
+func (r *Report) add(severity Severity, code string, ids []int, format string, args ...interface{}) {
+	r.Problems = append(r.Problems, Problem{
+		Severity: severity,
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+		Systems:  ids,
+	})
+	if severity == Error {
+		r.Errors++
+	} else {
+		r.Warnings++
+	}
+}
+
+// LoadError returns a report with one error for a file that could not be loaded,
+// so that tools reading reports see the failure like any other problem.
+func LoadError(err error) *Report {
+	r := &Report{Problems: []Problem{}}
+	r.add(Error, CodeLoad, nil, "%v", err)
+	return r
+}
+
+// Galaxy checks the systems in the store and returns the problems found.
+// Problems are grouped by check and are in the order of the systems in the store.
+func Galaxy(store *jsdb.Store, opts ...Option) (*Report, error) {
+	o := &options{}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, fmt.Errorf("validate: %w", err)
+		}
+	}
+	r := &Report{Problems: []Problem{}}
+	if store == nil {
+		return r, nil
+	}
+	// positions are kept so that messages can point at the system in the file
+	type entry struct {
+		*jsdb.System
+		position int // index in the file
+	}
+	var systems []entry
+	for i, system := range store.Systems {
+		if system != nil {
+			systems = append(systems, entry{System: system, position: i})
+		}
+	}
+	r.Systems = len(systems)
+	name := func(e entry) string {
+		return fmt.Sprintf("system #%d (id %d)", e.position+1, e.Id)
+	}
+
+	kindSeverity := Error
+	if o.lenient {
+		kindSeverity = Warning
+	}
+	ids := make(map[int]bool)
+	for _, system := range systems {
+		if system.Id == 0 {
+			r.add(kindSeverity, CodeMissingId, nil, "%s: missing id", name(system))
+		} else if ids[system.Id] {
+			r.add(Error, CodeDuplicateId, []int{system.Id}, "%s: duplicate id", name(system))
+		}
+		ids[system.Id] = true
+		if system.Kind == "" {
+			// not even the lenient load mode can keep a system without a kind
+			r.add(Error, CodeUnknownKind, []int{system.Id}, "%s: missing kind", name(system))
+		} else if _, ok := mem.ParseSystemKind(system.Kind); !ok {
+			r.add(kindSeverity, CodeUnknownKind, []int{system.Id}, "%s: unknown kind %q", name(system), system.Kind)
+		}
+		if o.bounds != 0 && (abs(system.X) > o.bounds || abs(system.Y) > o.bounds || abs(system.Z) > o.bounds) {
+			r.add(Error, CodeOutOfBounds, []int{system.Id}, "%s: (%d, %d, %d) is outside -%d..%d", name(system), system.X, system.Y, system.Z, o.bounds, o.bounds)
+		}
+	}
+
+	// group systems by coordinates, keeping the order of first appearance
+	type point struct{ x, y, z int }
+	var points []point
+	order := make(map[point]int) // index of the point in points
+	byPoint := make(map[point][]entry)
+	for _, system := range systems {
+		p := point{system.X, system.Y, system.Z}
+		if _, ok := byPoint[p]; !ok {
+			order[p] = len(points)
+			points = append(points, p)
+		}
+		byPoint[p] = append(byPoint[p], system)
+	}
+	dupSeverity := Warning
+	if o.minSeparation > 0 {
+		dupSeverity = Error
+	}
+	for _, p := range points {
+		if shared := byPoint[p]; len(shared) > 1 {
+			var ids []int
+			for _, system := range shared {
+				ids = append(ids, system.Id)
+			}
+			r.add(dupSeverity, CodeDuplicateCoordinates, ids, "(%d, %d, %d): %d systems share the coordinates", p.x, p.y, p.z, len(shared))
+		}
+	}
+
+	if o.minSeparation > 0 {
+		// bucket the points into cells at least as wide as the separation,
+		// so that only neighboring cells need to be checked
+		size := int(math.Ceil(o.minSeparation))
+		cell := func(p point) point {
+			return point{floorDiv(p.x, size), floorDiv(p.y, size), floorDiv(p.z, size)}
+		}
+		cells := make(map[point][]point)
+		for _, p := range points {
+			cells[cell(p)] = append(cells[cell(p)], p)
+		}
+		limit := o.minSeparation * o.minSeparation
+		for i, p := range points {
+			c := cell(p)
+			for dx := -1; dx <= 1; dx++ {
+				for dy := -1; dy <= 1; dy++ {
+					for dz := -1; dz <= 1; dz++ {
+						for _, q := range cells[point{c.x + dx, c.y + dy, c.z + dz}] {
+							// report each pair once, when visiting the point that appears first
+							if order[q] <= i {
+								continue
+							}
+							ddx, ddy, ddz := float64(p.x-q.x), float64(p.y-q.y), float64(p.z-q.z)
+							if d := ddx*ddx + ddy*ddy + ddz*ddz; d < limit {
+								a, b := byPoint[p][0], byPoint[q][0]
+								r.add(Error, CodeTooClose, []int{a.Id, b.Id},
+									"%s and %s: %.2f apart, less than %g", name(a), name(b), math.Sqrt(d), o.minSeparation)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return r, nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// floorDiv returns n / d rounded towards negative infinity.
+func floorDiv(n, d int) int {
+	q := n / d
+	if n%d != 0 && n < 0 {
+		q--
+	}
+	return q
+}
@@ -0,0 +1,202 @@
+/*
+ * lutymaps - a mapping engine for luty
+ *
+ * Copyright (c) 2023 2023 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package validate
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mdhender/lutymaps/pkg/stores/jsdb"
+	"reflect"
+	"testing"
+)
+
+// sys returns a system of a known kind.
+func sys(id, x, y, z int) *jsdb.System {
+	return &jsdb.System{Id: id, X: x, Y: y, Z: z, Kind: "Yellow Main Sequence"}
+}
+
+// withKind returns the system with its kind changed.
+func withKind(s *jsdb.System, kind string) *jsdb.System {
+	s.Kind = kind
+	return s
+}
+
+// finding is the part of a problem that the tests check.
+type finding struct {
+	severity Severity
+	code     string
+	message  string
+	systems  []int
+}
+
+func TestGalaxy(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		systems []*jsdb.System
+		opts    []Option
+		want    []finding
+	}{
+		{
+			name:    "clean",
+			systems: []*jsdb.System{sys(1, 0, 0, 0), nil, sys(2, 5, 5, 5)},
+			opts:    []Option{WithBounds(10), WithMinSeparation(2)},
+		},
+		{
+			name:    "duplicate coordinates are a warning without a separation",
+			systems: []*jsdb.System{sys(1, 1, 2, 3), sys(2, 1, 2, 3), sys(3, 0, 0, 0)},
+			want:    []finding{{Warning, CodeDuplicateCoordinates, "(1, 2, 3): 2 systems share the coordinates", []int{1, 2}}},
+		},
+		{
+			name:    "duplicate coordinates are an error with a separation",
+			systems: []*jsdb.System{sys(1, 1, 2, 3), sys(2, 1, 2, 3)},
+			opts:    []Option{WithMinSeparation(1)},
+			want:    []finding{{Error, CodeDuplicateCoordinates, "(1, 2, 3): 2 systems share the coordinates", []int{1, 2}}},
+		},
+		{
+			name:    "out of bounds",
+			systems: []*jsdb.System{sys(1, 10, -10, 0), sys(2, 0, -11, 0)},
+			opts:    []Option{WithBounds(10)},
+			want:    []finding{{Error, CodeOutOfBounds, "system #2 (id 2): (0, -11, 0) is outside -10..10", []int{2}}},
+		},
+		{
+			name:    "unknown kind is an error when strict",
+			systems: []*jsdb.System{withKind(sys(7, 0, 0, 0), "Pulsar")},
+			want:    []finding{{Error, CodeUnknownKind, `system #1 (id 7): unknown kind "Pulsar"`, []int{7}}},
+		},
+		{
+			name:    "unknown kind is a warning when lenient",
+			systems: []*jsdb.System{withKind(sys(7, 0, 0, 0), "Pulsar")},
+			opts:    []Option{WithLenient(true)},
+			want:    []finding{{Warning, CodeUnknownKind, `system #1 (id 7): unknown kind "Pulsar"`, []int{7}}},
+		},
+		{
+			name:    "missing kind is an error even when lenient",
+			systems: []*jsdb.System{withKind(sys(7, 0, 0, 0), "")},
+			opts:    []Option{WithLenient(true)},
+			want:    []finding{{Error, CodeUnknownKind, "system #1 (id 7): missing kind", []int{7}}},
+		},
+		{
+			name:    "missing id is an error when strict",
+			systems: []*jsdb.System{nil, sys(0, 0, 0, 0)},
+			want:    []finding{{Error, CodeMissingId, "system #2 (id 0): missing id", nil}},
+		},
+		{
+			name:    "missing id is a warning when lenient",
+			systems: []*jsdb.System{sys(0, 0, 0, 0)},
+			opts:    []Option{WithLenient(true)},
+			want:    []finding{{Warning, CodeMissingId, "system #1 (id 0): missing id", nil}},
+		},
+		{
+			name:    "duplicate id",
+			systems: []*jsdb.System{sys(4, 0, 0, 0), sys(4, 1, 1, 1)},
+			opts:    []Option{WithLenient(true)},
+			want:    []finding{{Error, CodeDuplicateId, "system #2 (id 4): duplicate id", []int{4}}},
+		},
+		{
+			name:    "too close",
+			systems: []*jsdb.System{sys(1, 0, 0, 0), sys(2, 1, 1, 0), sys(3, 9, 0, 0), sys(4, 3, 0, 0)},
+			opts:    []Option{WithMinSeparation(2)},
+			want:    []finding{{Error, CodeTooClose, "system #1 (id 1) and system #2 (id 2): 1.41 apart, less than 2", []int{1, 2}}},
+		},
+		{
+			name:    "too close across cells",
+			systems: []*jsdb.System{sys(1, -1, 0, 0), sys(2, 1, 0, 0)},
+			opts:    []Option{WithMinSeparation(2.5)},
+			want:    []finding{{Error, CodeTooClose, "system #1 (id 1) and system #2 (id 2): 2.00 apart, less than 2.5", []int{1, 2}}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := Galaxy(&jsdb.Store{Systems: tc.systems}, tc.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []finding
+			errors, warnings := 0, 0
+			for _, p := range r.Problems {
+				got = append(got, finding{p.Severity, p.Code, p.Message, p.Systems})
+				if p.Severity == Error {
+					errors++
+				} else {
+					warnings++
+				}
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("problems:\n\twant %v\n\tgot  %v", tc.want, got)
+			}
+			if r.Errors != errors || r.Warnings != warnings {
+				t.Errorf("counts: want %d errors, %d warnings: got %d, %d", errors, warnings, r.Errors, r.Warnings)
+			}
+			if r.HasErrors() != (errors != 0) || (r.Err() != nil) != (errors != 0) {
+				t.Errorf("errors: has errors %v, err %v: want errors %v", r.HasErrors(), r.Err(), errors != 0)
+			}
+		})
+	}
+}
+
+func TestOptions(t *testing.T) {
+	for _, opt := range []Option{WithBounds(-1), WithMinSeparation(-0.5)} {
+		if _, err := Galaxy(&jsdb.Store{}, opt); err == nil {
+			t.Errorf("want error: got nil")
+		}
+	}
+}
+
+// TestReportJSON checks the shape of a report as tools read it.
+func TestReportJSON(t *testing.T) {
+	r, err := Galaxy(&jsdb.Store{Systems: []*jsdb.System{sys(1, 0, 0, 0), sys(2, 0, 0, 0)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, report := range map[string]*Report{"galaxy": r, "load": LoadError(fmt.Errorf("bad file"))} {
+		buf, err := json.Marshal(report)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got map[string]interface{}
+		if err = json.Unmarshal(buf, &got); err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range []string{"systems", "errors", "warnings", "problems"} {
+			if _, ok := got[key]; !ok {
+				t.Errorf("%s: missing %q: %s", name, key, buf)
+			}
+		}
+		problems, ok := got["problems"].([]interface{})
+		if !ok || len(problems) != 1 {
+			t.Fatalf("%s: want 1 problem: got %s", name, buf)
+		}
+		for _, key := range []string{"severity", "code", "message", "systems"} {
+			if _, ok := problems[0].(map[string]interface{})[key]; !ok {
+				t.Errorf("%s: problem: missing %q: %s", name, key, buf)
+			}
+		}
+	}
+
+	buf, _ := json.Marshal(LoadError(fmt.Errorf("bad file")))
+	want := `{"systems":0,"errors":1,"warnings":0,"problems":[{"severity":"error","code":"load","message":"bad file","systems":null}]}`
+	if string(buf) != want {
+		t.Errorf("load error:\n\twant %s\n\tgot  %s", want, buf)
+	}
+}